@@ -0,0 +1,94 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// ExtensionService is the CRD describing an upstream Contour talks to on a
+// request's behalf: either as the host an HTTP-fetched Wasm module is
+// downloaded from, or as an authorization server a virtual host's
+// VirtualHost.Authz delegates request authorization to.
+type ExtensionService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ExtensionServiceSpec `json:"spec"`
+}
+
+// ExtensionServiceSpec is the spec of an ExtensionService.
+type ExtensionServiceSpec struct {
+	// Service is the Kubernetes Service Contour dials for this
+	// ExtensionService, in the ExtensionService's own namespace.
+	Service *ServiceRef `json:"service"`
+
+	// Protocol is the protocol Contour speaks to Service when this
+	// ExtensionService is used as an authorization server: "grpc" (the
+	// default) or "http".
+	Protocol string `json:"protocol,omitempty"`
+
+	// TLS, if set, has Contour dial Service over TLS.
+	TLS *ExtensionServiceTLS `json:"tls,omitempty"`
+
+	// Timeout is the default timeout of authorization checks sent to
+	// Service, overridable by VirtualHost.Authz.ResponseTimeout. It does not
+	// apply to Wasm module fetches, which use a fixed 10s timeout.
+	Timeout string `json:"timeout,omitempty"`
+
+	// FailureModeAllow, when this ExtensionService is used as an
+	// authorization server, has Contour allow the request through if the
+	// call to Service fails, instead of denying it.
+	FailureModeAllow bool `json:"failureModeAllow,omitempty"`
+
+	// IncludedHeaders lists the request headers forwarded to Service when
+	// this ExtensionService is used as an authorization server.
+	IncludedHeaders []string `json:"includedHeaders,omitempty"`
+
+	// WasmModule, if set, makes this ExtensionService usable as a Wasm
+	// filter's module source (VirtualHost.Wasm[].ExtensionService), fetched
+	// over HTTP through Service.
+	WasmModule *WasmModuleSource `json:"wasmModule,omitempty"`
+}
+
+// ExtensionServiceTLS configures how Contour dials Service over TLS.
+type ExtensionServiceTLS struct {
+	// SNI is the server name Contour validates Service's certificate
+	// against, defaulting to Service.Name when empty.
+	SNI string `json:"sni,omitempty"`
+}
+
+// ServiceRef names a Kubernetes Service and port backing an
+// ExtensionService.
+type ServiceRef struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// WasmModuleSource describes where a Wasm module's bytes come from.
+// Exactly one of HTTPPath, Inline should be set; SHA256 is required
+// whenever HTTPPath is set so Envoy can validate the fetched module before
+// loading it.
+type WasmModuleSource struct {
+	// HTTPPath is the path requested on ExtensionServiceSpec.Service to
+	// fetch the module.
+	HTTPPath string `json:"httpPath,omitempty"`
+
+	// Inline is the module's bytes, base64-encoded.
+	Inline string `json:"inline,omitempty"`
+
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Runtime selects the VM Envoy uses to execute the module: "v8" or
+	// "wavm". Defaults to "v8".
+	Runtime string `json:"runtime,omitempty"`
+}
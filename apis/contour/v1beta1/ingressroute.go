@@ -0,0 +1,188 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package v1beta1 holds the CRD types IngressRoute, JWTProvider and
+// ExtensionService, and the status conventions Contour's DAG processors
+// read from and write back to them.
+package v1beta1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// IngressRoute is the CRD Contour watches, alongside Ingress, to build its
+// DAG. It describes one virtual host and the routes served under it.
+type IngressRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IngressRouteSpec `json:"spec"`
+	Status Status           `json:"status,omitempty"`
+}
+
+// IngressRouteSpec is the spec of an IngressRoute.
+type IngressRouteSpec struct {
+	VirtualHost *VirtualHost `json:"virtualhost,omitempty"`
+	Routes      []Route      `json:"routes"`
+}
+
+// VirtualHost holds the properties of an IngressRoute that apply to every
+// route it serves.
+type VirtualHost struct {
+	Fqdn string `json:"fqdn"`
+
+	// Authorization is the RBAC policy every Route under this virtual host
+	// enforces unless it sets its own Route.Authorization override.
+	Authorization *AuthorizationPolicy `json:"authorization,omitempty"`
+
+	// JWT lists the JWTProviders a Route under this virtual host may
+	// require a token from.
+	JWT []JWTProviderRef `json:"jwt,omitempty"`
+
+	// Wasm lists the Wasm modules Contour inserts into this virtual host's
+	// filter chain, ahead of Authorization's RBAC filter.
+	Wasm []WasmFilterRef `json:"wasm,omitempty"`
+
+	// AccessLog, if set, overrides `contour serve`'s --access-log-format
+	// sink for requests to this virtual host.
+	AccessLog *AccessLogConfig `json:"accessLog,omitempty"`
+
+	// Authz, if set, delegates authorization decisions for this virtual
+	// host's requests to an ExtensionService, ahead of Authorization's RBAC
+	// filter.
+	Authz *AuthorizationConfig `json:"authz,omitempty"`
+}
+
+// AuthorizationConfig names the ExtensionService a virtual host's requests
+// are authorized against.
+type AuthorizationConfig struct {
+	// ExtensionService names the ExtensionService (in the IngressRoute's
+	// namespace) Contour sends authorization checks to.
+	ExtensionService string `json:"extensionService"`
+
+	// ResponseTimeout overrides the ExtensionService's default Timeout for
+	// authorization checks.
+	ResponseTimeout string `json:"responseTimeout,omitempty"`
+
+	// FailureModeAllow, if true, turns on failure-mode-allow for
+	// authorization checks made on this virtual host's behalf even when the
+	// ExtensionService's own FailureModeAllow is false. Leaving it false
+	// keeps the ExtensionService's setting.
+	FailureModeAllow bool `json:"failureModeAllow,omitempty"`
+}
+
+// AccessLogConfig selects and configures this virtual host's access log
+// sink, overriding `contour serve`'s default. Format selects the sink
+// ("json" or the default "envoy" text format); FormatString and
+// JSONFields are only meaningful for their respective Format.
+type AccessLogConfig struct {
+	Format       string            `json:"format,omitempty"`
+	FormatString string            `json:"formatString,omitempty"`
+	JSONFields   map[string]string `json:"jsonFields,omitempty"`
+}
+
+// JWTProviderRef names a JWTProvider object this virtual host accepts
+// tokens from.
+type JWTProviderRef struct {
+	Name string `json:"name"`
+}
+
+// WasmFilterRef references the ExtensionService a virtual host's Wasm
+// filter loads its module from.
+type WasmFilterRef struct {
+	// Name identifies this filter instance in the HTTP filter chain, so a
+	// Route can disable it by name.
+	Name string `json:"name"`
+
+	// ExtensionService names the ExtensionService (in the IngressRoute's
+	// namespace) whose Spec.WasmModule supplies this filter's module.
+	ExtensionService string `json:"extensionService"`
+
+	// Config is the opaque per-instance JSON configuration for the module.
+	// It is not carried into the generated filter: the module's root
+	// context is given an empty configuration.
+	Config string `json:"config,omitempty"`
+}
+
+// Route is a request-matching rule and the Services it forwards matching
+// requests to.
+type Route struct {
+	Match    string    `json:"match"`
+	Services []Service `json:"services"`
+
+	// Authorization, if set, overrides the enclosing VirtualHost's
+	// Authorization for this route.
+	Authorization *AuthorizationPolicy `json:"authorization,omitempty"`
+
+	// JWT, if set, requires this route's requests to carry a valid token
+	// from one of the named JWTProviders.
+	JWT *JWTRequirement `json:"jwt,omitempty"`
+
+	// WasmDisabled lists the names (VirtualHost.Wasm[].Name) of Wasm
+	// filters this route opts out of.
+	WasmDisabled []string `json:"wasmDisabled,omitempty"`
+}
+
+// Service is one weighted backend a Route forwards matching requests to.
+type Service struct {
+	Name   string `json:"name"`
+	Port   int    `json:"port"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// AuthorizationPolicy is an RBAC policy: a default action for requests that
+// match none of Rules, and the allow/deny Rules themselves.
+type AuthorizationPolicy struct {
+	// DefaultAction is "Allow" or "Deny" for requests matching no Rule.
+	DefaultAction string `json:"defaultAction,omitempty"`
+
+	// Disabled turns off RBAC enforcement for this virtual host or route,
+	// overriding an enclosing VirtualHost.Authorization.
+	Disabled bool `json:"disabled,omitempty"`
+
+	Rules []AuthorizationRule `json:"rules,omitempty"`
+}
+
+// AuthorizationRule pairs a set of Principals with the request attributes
+// (Methods, Paths) they are allowed (or denied) to exercise. A zero value
+// Permission (empty Methods and Paths) matches any request.
+type AuthorizationRule struct {
+	Principals []Principal `json:"principals,omitempty"`
+	Methods    []string    `json:"methods,omitempty"`
+	Paths      []string    `json:"paths,omitempty"`
+}
+
+// Principal identifies a downstream peer an AuthorizationRule applies to,
+// either by mTLS identity (Namespace/ServiceAccount, ServiceAccount empty
+// meaning any service account in Namespace) or by a claim a JWT provider
+// has already verified (JWTClaim/JWTClaimValue, checked against the
+// VirtualHost's first JWT provider unless JWTProvider names another).
+type Principal struct {
+	Namespace      string `json:"namespace,omitempty"`
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	JWTProvider    string `json:"jwtProvider,omitempty"`
+	JWTClaim       string `json:"jwtClaim,omitempty"`
+	JWTClaimValue  string `json:"jwtClaimValue,omitempty"`
+}
+
+// JWTRequirement says which of a virtual host's JWTProviders (by name) a
+// Route requires a valid token from.
+type JWTRequirement struct {
+	ProviderNames []string `json:"providerNames,omitempty"`
+	RequireAll    bool     `json:"requireAll,omitempty"`
+}
+
+// Status is the subset of the IngressRoute status conditions convention
+// Contour writes back to the object.
+type Status struct {
+	CurrentStatus string `json:"currentStatus,omitempty"`
+	Description   string `json:"description,omitempty"`
+}
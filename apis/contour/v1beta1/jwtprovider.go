@@ -0,0 +1,50 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// JWTProvider is the CRD describing a single JWT issuer IngressRoute's
+// virtualhost.jwt entries reference by name.
+type JWTProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec JWTProviderSpec `json:"spec"`
+}
+
+// JWTProviderSpec is the spec of a JWTProvider.
+type JWTProviderSpec struct {
+	Issuer    string   `json:"issuer"`
+	Audiences []string `json:"audiences,omitempty"`
+
+	// JWKS locates the provider's key set; exactly one of JWKS.URI or
+	// JWKS.Keys should be set.
+	JWKS *JWKS `json:"jwks"`
+
+	// ForwardJWT, if true, forwards the verified token to the upstream
+	// service in its original header.
+	ForwardJWT bool `json:"forwardJWT,omitempty"`
+
+	// ClaimToHeaders maps verified claim names to header names Contour
+	// sets on the forwarded request.
+	ClaimToHeaders map[string]string `json:"claimToHeaders,omitempty"`
+}
+
+// JWKS locates a JWTProvider's key set, by JWKS URI (fetched through an
+// Envoy cluster Contour synthesizes) or inline.
+type JWKS struct {
+	URI  string `json:"uri,omitempty"`
+	Keys string `json:"keys,omitempty"`
+}
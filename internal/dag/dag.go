@@ -0,0 +1,283 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+// DAG is the intermediate representation Contour's processors (IngressRoute,
+// Ingress, GatewayAPIProcessor) build from Kubernetes configuration on each
+// update. A separate xDS visitor walks the DAG to produce Envoy's CDS/RDS/LDS
+// resources, reusing the envoy package's filter and listener builders; the
+// DAG itself holds no Envoy types so that translation stays independent of
+// any one source API.
+type DAG struct {
+	// virtualhosts holds the virtual hosts currently in the DAG, keyed by
+	// hostname.
+	virtualhosts map[string]*VirtualHost
+}
+
+// AddVirtualHost adds vhost to the DAG, replacing any existing virtual host
+// with the same name.
+func (d *DAG) AddVirtualHost(vhost *VirtualHost) {
+	if d.virtualhosts == nil {
+		d.virtualhosts = make(map[string]*VirtualHost)
+	}
+	d.virtualhosts[vhost.Name] = vhost
+}
+
+// VirtualHost returns the virtual host named name, creating and adding an
+// empty one to the DAG if it does not already exist.
+func (d *DAG) VirtualHost(name string) *VirtualHost {
+	if vhost, ok := d.virtualhosts[name]; ok {
+		return vhost
+	}
+	vhost := &VirtualHost{Name: name}
+	d.AddVirtualHost(vhost)
+	return vhost
+}
+
+// VirtualHosts returns the virtual hosts currently in the DAG.
+func (d *DAG) VirtualHosts() []*VirtualHost {
+	vhosts := make([]*VirtualHost, 0, len(d.virtualhosts))
+	for _, vhost := range d.virtualhosts {
+		vhosts = append(vhosts, vhost)
+	}
+	return vhosts
+}
+
+// VirtualHost is a hostname and the routes or TCP proxying configured for
+// it. A VirtualHost with Routes set is rendered as an RDS virtual host; one
+// with TCPProxy set is rendered as a TCP listener filter chain selected by
+// SNI, as used for TLSRoute/TCPRoute passthrough.
+type VirtualHost struct {
+	Name     string
+	Routes   []*Route
+	TCPProxy *TCPProxy
+
+	// AuthorizationPolicy is the RBAC policy this virtual host's routes
+	// enforce unless a Route sets its own AuthorizationPolicy override,
+	// compiled by IngressRouteProcessor from virtualhost.authorization.
+	AuthorizationPolicy *AuthorizationPolicy
+
+	// JWTProviders are the JWT issuers this virtual host's routes may
+	// require a token from, compiled from virtualhost.jwt.
+	JWTProviders []JWTProvider
+
+	// WasmFilters are inserted into this virtual host's filter chain ahead
+	// of AuthorizationPolicy's RBAC filter, compiled from virtualhost.wasm.
+	WasmFilters []WasmFilter
+
+	// AccessLog, if set, overrides `contour serve`'s default access log
+	// sink for this virtual host, compiled from virtualhost.accessLog.
+	AccessLog *AccessLogPolicy
+
+	// AuthorizationService, if set, delegates authorization decisions for
+	// this virtual host's requests to an external authorization server,
+	// compiled from virtualhost.authz and the ExtensionService it names.
+	AuthorizationService *AuthorizationService
+}
+
+// TCPProxy is an SNI- or listener-selected proxy straight to a set of
+// clusters, with no HTTP-layer routing.
+type TCPProxy struct {
+	Clusters []*Cluster
+}
+
+// Route is a request-matching rule and the weighted set of Clusters it
+// forwards matching requests to, plus any filters applied along the way.
+type Route struct {
+	PathMatchCondition    MatchCondition
+	HeaderMatchConditions []HeaderMatchCondition
+	Clusters              []*Cluster
+
+	// RequestHeadersPolicy holds header additions/removals applied to the
+	// request before it is forwarded, from an HTTPRoute RequestHeaderModifier
+	// filter.
+	RequestHeadersPolicy *HeadersPolicy
+
+	// MirrorPolicy, if set, additionally sends a copy of the request to
+	// Cluster, from an HTTPRoute RequestMirror filter.
+	MirrorPolicy *Cluster
+
+	// Redirect, if set, answers matching requests with a redirect rather
+	// than forwarding to Clusters, from an HTTPRoute RequestRedirect filter.
+	Redirect *Redirect
+
+	// AuthorizationPolicy, if set, overrides the enclosing VirtualHost's
+	// AuthorizationPolicy for this route.
+	AuthorizationPolicy *AuthorizationPolicy
+
+	// JWTRequirement, if set, requires this route's requests to carry a
+	// valid token from one of the enclosing VirtualHost's JWTProviders.
+	JWTRequirement *JWTRequirement
+
+	// WasmDisabled lists the Name of the enclosing VirtualHost's
+	// WasmFilters this route opts out of.
+	WasmDisabled []string
+}
+
+// MatchCondition is satisfied by PrefixMatchCondition and ExactMatchCondition.
+type MatchCondition interface {
+	isMatchCondition()
+}
+
+// PrefixMatchCondition matches a request whose path starts with Prefix.
+type PrefixMatchCondition struct {
+	Prefix string
+}
+
+func (PrefixMatchCondition) isMatchCondition() {}
+
+// ExactMatchCondition matches a request whose path equals Path exactly.
+type ExactMatchCondition struct {
+	Path string
+}
+
+func (ExactMatchCondition) isMatchCondition() {}
+
+// HeaderMatchCondition matches a request header against Value, per MatchType
+// ("exact" or "regex"); Invert negates the match.
+type HeaderMatchCondition struct {
+	Name      string
+	Value     string
+	MatchType string
+	Invert    bool
+}
+
+// HeadersPolicy is the set of header mutations applied to a request or
+// response as it passes through a Route.
+type HeadersPolicy struct {
+	Set    map[string]string
+	Remove []string
+}
+
+// Redirect is the response a Route returns instead of forwarding a request.
+type Redirect struct {
+	Hostname   string
+	StatusCode int
+}
+
+// Cluster holds the weighted split of traffic to a single Service, as part
+// of a Route's or TCPProxy's forwarding action. The cluster name Envoy uses
+// on the wire is produced from Upstream by envoy.Clustername at xDS-render
+// time, so adding a Cluster here requires no change to CDS caching.
+type Cluster struct {
+	Upstream *Service
+	Weight   int
+}
+
+// Service identifies the Kubernetes Service and port Contour forwards
+// traffic to.
+type Service struct {
+	Namespace string
+	Name      string
+	Port      int32
+}
+
+// AuthorizationPolicy is an RBAC policy: a default action for requests that
+// match none of Rules, and the allow/deny Rules themselves, compiled by
+// IngressRouteProcessor from IngressRoute's AuthorizationPolicy CRD field.
+type AuthorizationPolicy struct {
+	// DefaultAction is the action ("ALLOW" or "DENY") Envoy's RBAC filter
+	// applies when a request matches no Rule.
+	DefaultAction string
+
+	// Disabled turns off RBAC enforcement for this virtual host or route.
+	Disabled bool
+
+	Rules []AuthorizationRule
+}
+
+// AuthorizationRule pairs a set of Principals with the request attributes
+// (Methods, Paths) they are allowed (or denied, depending on the enclosing
+// AuthorizationPolicy's DefaultAction) to exercise. A rule with empty
+// Methods and Paths matches any request.
+type AuthorizationRule struct {
+	Principals []AuthorizationPrincipal
+	Methods    []string
+	Paths      []string
+}
+
+// AuthorizationPrincipal identifies a downstream peer an AuthorizationRule
+// applies to, either by mTLS identity (Namespace/ServiceAccount,
+// ServiceAccount empty meaning any service account in Namespace) or by a
+// claim a JWTProvider has already verified (JWTProvider/JWTClaim/
+// JWTClaimValue).
+type AuthorizationPrincipal struct {
+	Namespace      string
+	ServiceAccount string
+	JWTProvider    string
+	JWTClaim       string
+	JWTClaimValue  string
+}
+
+// JWTProvider is a JWT issuer a VirtualHost's routes may require a valid
+// token from, compiled by IngressRouteProcessor from a JWTProvider CRD
+// object. JWKSHost/JWKSPort are set, parsed from JWKSURI, when the key set
+// is fetched remotely, so whatever renders a CDS cluster for it dials the
+// provider's actual JWKS endpoint rather than a host invented from the
+// provider's name; Keys is set instead for an inline key set.
+type JWTProvider struct {
+	Name           string
+	Issuer         string
+	Audiences      []string
+	JWKSURI        string
+	JWKSHost       string
+	JWKSPort       int32
+	Keys           string
+	ForwardJWT     bool
+	ClaimToHeaders map[string]string
+}
+
+// JWTRequirement says which of a VirtualHost's JWTProviders (by name) a
+// Route requires a valid token from.
+type JWTRequirement struct {
+	ProviderNames []string
+	RequireAll    bool
+}
+
+// WasmFilter is a Wasm module Contour inserts into a VirtualHost's filter
+// chain, compiled by IngressRouteProcessor from virtualhost.wasm and the
+// ExtensionService it names. Upstream is set when the module is fetched
+// remotely over HTTP, so it renders into a CDS cluster the same way a
+// Route's Clusters are.
+type WasmFilter struct {
+	Name     string
+	Runtime  string
+	Upstream *Service
+	HTTPPath string
+	Inline   []byte
+	SHA256   string
+}
+
+// AccessLogPolicy selects and configures a VirtualHost's access log sink,
+// compiled by IngressRouteProcessor from virtualhost.accessLog. Format is
+// "json" or the default "envoy" text format; FormatString and JSONFields
+// are only meaningful for their respective Format.
+type AccessLogPolicy struct {
+	Format       string
+	FormatString string
+	JSONFields   map[string]string
+}
+
+// AuthorizationService is an external authorization server a VirtualHost's
+// requests are checked against ahead of its RBAC filter, compiled by
+// IngressRouteProcessor from virtualhost.authz and the ExtensionService it
+// names. GRPC selects the ext_authz gRPC transport; the HTTP (raw_http)
+// transport otherwise.
+type AuthorizationService struct {
+	Upstream         *Service
+	GRPC             bool
+	Timeout          string
+	FailureModeAllow bool
+	IncludedHeaders  []string
+}
@@ -0,0 +1,418 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	gatewayapi_v1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// GatewayAPIProcessor translates Gateway API resources into the DAG
+// alongside the existing IngressRoute and Ingress processors, so a single
+// Contour instance can serve both APIs from the same xDS caches.
+//
+// It watches GatewayClass, Gateway, HTTPRoute, TLSRoute, TCPRoute and
+// ReferenceGrant objects. The DAG nodes it produces (VirtualHost, Route,
+// TCPProxy, Cluster) are the same ones the IngressRoute and Ingress
+// processors build, so the xDS visitor that walks the DAG to render
+// listeners and clusters (reusing envoy.TLSInspector, envoy.HTTPConnectionManager
+// and envoy.Clustername) needs no Gateway API-specific code.
+type GatewayAPIProcessor struct {
+	// ControllerName is the value Gateway.spec.gatewayClassName resolves to
+	// via a matching GatewayClass.spec.controllerName. Gateways whose class
+	// does not resolve to this controller are ignored.
+	ControllerName string
+
+	// Source supplies the Gateway API objects currently known to the cluster.
+	Source GatewayAPICache
+}
+
+// GatewayAPICache is the subset of an informer-backed cache the processor
+// needs. It is satisfied by the Gateway API watcher added alongside the
+// existing IngressRoute/Ingress KubernetesCache.
+type GatewayAPICache interface {
+	GatewayClasses() []*gatewayapi_v1alpha2.GatewayClass
+	Gateways() []*gatewayapi_v1alpha2.Gateway
+	HTTPRoutes() []*gatewayapi_v1alpha2.HTTPRoute
+	TLSRoutes() []*gatewayapi_v1alpha2.TLSRoute
+	TCPRoutes() []*gatewayapi_v1alpha2.TCPRoute
+	ReferenceGrants() []*gatewayapi_v1alpha2.ReferenceGrant
+}
+
+// Run builds listeners and virtual hosts for every Gateway this processor is
+// responsible for and adds them to dag, then attaches the HTTPRoutes,
+// TLSRoutes and TCPRoutes matched to each listener. It returns the
+// RouteParentStatus conditions to be written back onto the source route
+// objects.
+func (p *GatewayAPIProcessor) Run(dag *DAG) []RouteParentStatusUpdate {
+	var updates []RouteParentStatusUpdate
+
+	for _, gw := range p.Source.Gateways() {
+		if !p.manages(gw) {
+			continue
+		}
+
+		for _, listener := range gw.Spec.Listeners {
+			vhost := p.buildListener(dag, gw, listener)
+
+			for _, route := range p.Source.HTTPRoutes() {
+				if !routeAttachesToListener(route.Spec.ParentRefs, gw, listener) {
+					continue
+				}
+				updates = append(updates, p.attachHTTPRoute(vhost, route))
+			}
+
+			for _, route := range p.Source.TLSRoutes() {
+				if !routeAttachesToListener(route.Spec.ParentRefs, gw, listener) {
+					continue
+				}
+				updates = append(updates, p.attachTLSRoute(dag, route))
+			}
+
+			for _, route := range p.Source.TCPRoutes() {
+				if !routeAttachesToListener(route.Spec.ParentRefs, gw, listener) {
+					continue
+				}
+				updates = append(updates, p.attachTCPRoute(vhost, route))
+			}
+		}
+	}
+
+	return updates
+}
+
+// manages reports whether gw's GatewayClass resolves to this processor's
+// controller, per the GatewayClass.spec.controllerName indirection.
+func (p *GatewayAPIProcessor) manages(gw *gatewayapi_v1alpha2.Gateway) bool {
+	for _, class := range p.Source.GatewayClasses() {
+		if class.Name != string(gw.Spec.GatewayClassName) {
+			continue
+		}
+		return string(class.Spec.ControllerName) == p.ControllerName
+	}
+	return false
+}
+
+// buildListener records a virtual host in dag for listener, keyed by its
+// hostname (empty for a listener with no Hostname, such as a raw TCP
+// listener). The xDS visitor is responsible for turning this, and the
+// listener's TLS settings, into an actual Envoy listener.
+func (p *GatewayAPIProcessor) buildListener(dag *DAG, gw *gatewayapi_v1alpha2.Gateway, listener gatewayapi_v1alpha2.Listener) *VirtualHost {
+	return dag.VirtualHost(string(listener.Hostname))
+}
+
+// attachHTTPRoute translates an HTTPRoute's rules into routes on vhost, one
+// DAG Route per (match, rule) pair since HTTPRouteMatch entries are ORed
+// while the conditions within a single match are ANDed. Per-rule filters
+// (RequestHeaderModifier, RequestMirror, RequestRedirect) become the
+// resulting Route's RequestHeadersPolicy, MirrorPolicy and Redirect.
+// Cross-namespace backendRefs are only honoured when a ReferenceGrant in the
+// backend's namespace permits the reference.
+func (p *GatewayAPIProcessor) attachHTTPRoute(vhost *VirtualHost, route *gatewayapi_v1alpha2.HTTPRoute) RouteParentStatusUpdate {
+	update := RouteParentStatusUpdate{Route: route}
+
+	for _, rule := range route.Spec.Rules {
+		var clusters []*Cluster
+		for _, backend := range rule.BackendRefs {
+			if !p.backendRefAllowed(route.Namespace, "HTTPRoute", backend.Namespace) {
+				update.Conditions = append(update.Conditions, refNotPermittedCondition())
+				continue
+			}
+			clusters = append(clusters, &Cluster{
+				Upstream: serviceForBackendRef(route.Namespace, backend.BackendRef),
+				Weight:   backendWeight(backend),
+			})
+		}
+		if len(clusters) == 0 {
+			continue
+		}
+
+		headersPolicy, mirror, redirect := httpFilterPolicies(route.Namespace, rule.Filters)
+
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []gatewayapi_v1alpha2.HTTPRouteMatch{{}}
+		}
+		for _, match := range matches {
+			vhost.Routes = append(vhost.Routes, &Route{
+				PathMatchCondition:    pathMatchCondition(match),
+				HeaderMatchConditions: headerMatchConditions(match),
+				Clusters:              clusters,
+				RequestHeadersPolicy:  headersPolicy,
+				MirrorPolicy:          mirror,
+				Redirect:              redirect,
+			})
+		}
+	}
+
+	if len(update.Conditions) == 0 {
+		update.Conditions = []RouteParentCondition{acceptedCondition()}
+	}
+	return update
+}
+
+// attachTLSRoute translates a TLSRoute's backends into an SNI-selected
+// TCPProxy on one virtual host per hostname the route lists (TLSRoute
+// routing has no HTTP-layer matching, only SNI).
+func (p *GatewayAPIProcessor) attachTLSRoute(dag *DAG, route *gatewayapi_v1alpha2.TLSRoute) RouteParentStatusUpdate {
+	update := RouteParentStatusUpdate{Route: route}
+
+	var backends []gatewayapi_v1alpha2.BackendRef
+	for _, rule := range route.Spec.Rules {
+		backends = append(backends, rule.BackendRefs...)
+	}
+	clusters := p.backendRefClusters(route.Namespace, "TLSRoute", &update, backends)
+
+	hostnames := route.Spec.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = []gatewayapi_v1alpha2.Hostname{""}
+	}
+	for _, hostname := range hostnames {
+		dag.VirtualHost(string(hostname)).TCPProxy = &TCPProxy{Clusters: clusters}
+	}
+
+	if len(update.Conditions) == 0 {
+		update.Conditions = []RouteParentCondition{acceptedCondition()}
+	}
+	return update
+}
+
+// attachTCPRoute translates a TCPRoute's backends into a TCPProxy on the
+// listener's own virtual host; TCPRoute routing is by listener alone, with
+// no hostname or HTTP-layer matching.
+func (p *GatewayAPIProcessor) attachTCPRoute(vhost *VirtualHost, route *gatewayapi_v1alpha2.TCPRoute) RouteParentStatusUpdate {
+	update := RouteParentStatusUpdate{Route: route}
+
+	var backends []gatewayapi_v1alpha2.BackendRef
+	for _, rule := range route.Spec.Rules {
+		backends = append(backends, rule.BackendRefs...)
+	}
+	vhost.TCPProxy = &TCPProxy{
+		Clusters: p.backendRefClusters(route.Namespace, "TCPRoute", &update, backends),
+	}
+
+	if len(update.Conditions) == 0 {
+		update.Conditions = []RouteParentCondition{acceptedCondition()}
+	}
+	return update
+}
+
+// backendRefClusters builds the Clusters for a flattened set of
+// TLSRoute/TCPRoute backendRefs, appending a RefNotPermitted condition to
+// update for any backendRef a ReferenceGrant does not permit.
+func (p *GatewayAPIProcessor) backendRefClusters(routeNamespace, routeKind string, update *RouteParentStatusUpdate, backends []gatewayapi_v1alpha2.BackendRef) []*Cluster {
+	var clusters []*Cluster
+	for _, backend := range backends {
+		if !p.backendRefAllowed(routeNamespace, routeKind, backend.Namespace) {
+			update.Conditions = append(update.Conditions, refNotPermittedCondition())
+			continue
+		}
+		clusters = append(clusters, &Cluster{
+			Upstream: serviceForBackendRef(routeNamespace, backend),
+			Weight:   tcpBackendWeight(backend),
+		})
+	}
+	return clusters
+}
+
+// backendRefAllowed reports whether a route of routeKind in routeNamespace
+// may reference a backend in backendNamespace (the route's own namespace
+// when backendNamespace is nil), consulting ReferenceGrants when the two
+// differ.
+func (p *GatewayAPIProcessor) backendRefAllowed(routeNamespace, routeKind string, backendNamespace *gatewayapi_v1alpha2.Namespace) bool {
+	ns := routeNamespace
+	if backendNamespace != nil {
+		ns = string(*backendNamespace)
+	}
+	if ns == routeNamespace {
+		return true
+	}
+	for _, grant := range p.Source.ReferenceGrants() {
+		if grant.Namespace != ns {
+			continue
+		}
+		if referenceGrantPermits(grant, routeNamespace, routeKind) {
+			return true
+		}
+	}
+	return false
+}
+
+func referenceGrantPermits(grant *gatewayapi_v1alpha2.ReferenceGrant, fromNamespace, fromKind string) bool {
+	for _, from := range grant.Spec.From {
+		if string(from.Namespace) == fromNamespace && string(from.Kind) == fromKind {
+			return true
+		}
+	}
+	return false
+}
+
+func routeAttachesToListener(refs []gatewayapi_v1alpha2.ParentReference, gw *gatewayapi_v1alpha2.Gateway, listener gatewayapi_v1alpha2.Listener) bool {
+	for _, ref := range refs {
+		if string(ref.Name) != gw.Name {
+			continue
+		}
+		if ref.SectionName == nil || *ref.SectionName == listener.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceForBackendRef resolves a BackendRef to the DAG Service it
+// identifies, defaulting an unset Namespace to routeNamespace per the
+// Gateway API's cross-namespace reference convention.
+func serviceForBackendRef(routeNamespace string, ref gatewayapi_v1alpha2.BackendRef) *Service {
+	namespace := routeNamespace
+	if ref.Namespace != nil {
+		namespace = string(*ref.Namespace)
+	}
+	var port int32
+	if ref.Port != nil {
+		port = int32(*ref.Port)
+	}
+	return &Service{
+		Namespace: namespace,
+		Name:      string(ref.Name),
+		Port:      port,
+	}
+}
+
+// pathMatchCondition translates an HTTPRouteMatch's path match into the
+// equivalent DAG MatchCondition, defaulting to a "/" prefix when the match
+// omits a path (matching any request, per the Gateway API default).
+func pathMatchCondition(match gatewayapi_v1alpha2.HTTPRouteMatch) MatchCondition {
+	if match.Path == nil || match.Path.Value == nil {
+		return PrefixMatchCondition{Prefix: "/"}
+	}
+	value := *match.Path.Value
+	if match.Path.Type != nil && *match.Path.Type == gatewayapi_v1alpha2.PathMatchExact {
+		return ExactMatchCondition{Path: value}
+	}
+	return PrefixMatchCondition{Prefix: value}
+}
+
+// headerMatchConditions translates an HTTPRouteMatch's header matches into
+// the equivalent DAG HeaderMatchConditions.
+func headerMatchConditions(match gatewayapi_v1alpha2.HTTPRouteMatch) []HeaderMatchCondition {
+	conditions := make([]HeaderMatchCondition, 0, len(match.Headers))
+	for _, h := range match.Headers {
+		matchType := "exact"
+		if h.Type != nil && *h.Type == gatewayapi_v1alpha2.HeaderMatchRegularExpression {
+			matchType = "regex"
+		}
+		conditions = append(conditions, HeaderMatchCondition{
+			Name:      string(h.Name),
+			Value:     h.Value,
+			MatchType: matchType,
+		})
+	}
+	return conditions
+}
+
+// httpFilterPolicies translates an HTTPRouteRule's filters into the Route
+// fields they affect. Gateway API allows each filter type at most once per
+// rule, so the last of each type wins.
+func httpFilterPolicies(routeNamespace string, filters []gatewayapi_v1alpha2.HTTPRouteFilter) (*HeadersPolicy, *Cluster, *Redirect) {
+	var headers *HeadersPolicy
+	var mirror *Cluster
+	var redirect *Redirect
+
+	for _, f := range filters {
+		switch f.Type {
+		case gatewayapi_v1alpha2.HTTPRouteFilterRequestHeaderModifier:
+			if f.RequestHeaderModifier != nil {
+				headers = requestHeadersPolicy(f.RequestHeaderModifier)
+			}
+		case gatewayapi_v1alpha2.HTTPRouteFilterRequestMirror:
+			if f.RequestMirror != nil {
+				mirror = &Cluster{
+					Upstream: serviceForBackendRef(routeNamespace, f.RequestMirror.BackendRef),
+					Weight:   1,
+				}
+			}
+		case gatewayapi_v1alpha2.HTTPRouteFilterRequestRedirect:
+			if f.RequestRedirect != nil {
+				redirect = redirectFromFilter(f.RequestRedirect)
+			}
+		}
+	}
+	return headers, mirror, redirect
+}
+
+func requestHeadersPolicy(f *gatewayapi_v1alpha2.HTTPRequestHeaderFilter) *HeadersPolicy {
+	set := make(map[string]string, len(f.Set))
+	for _, h := range f.Set {
+		set[string(h.Name)] = h.Value
+	}
+	return &HeadersPolicy{Set: set, Remove: f.Remove}
+}
+
+func redirectFromFilter(f *gatewayapi_v1alpha2.HTTPRequestRedirectFilter) *Redirect {
+	// HTTPRequestRedirectFilter.StatusCode defaults to 302 per the Gateway
+	// API spec when the field is left unset.
+	redirect := &Redirect{StatusCode: 302}
+	if f.Hostname != nil {
+		redirect.Hostname = string(*f.Hostname)
+	}
+	if f.StatusCode != nil {
+		redirect.StatusCode = *f.StatusCode
+	}
+	return redirect
+}
+
+func backendWeight(backend gatewayapi_v1alpha2.HTTPBackendRef) int {
+	if backend.Weight == nil {
+		return 1
+	}
+	return int(*backend.Weight)
+}
+
+func tcpBackendWeight(backend gatewayapi_v1alpha2.BackendRef) int {
+	if backend.Weight == nil {
+		return 1
+	}
+	return int(*backend.Weight)
+}
+
+func refNotPermittedCondition() RouteParentCondition {
+	return RouteParentCondition{
+		Type:   "ResolvedRefs",
+		Status: "False",
+		Reason: "RefNotPermitted",
+	}
+}
+
+func acceptedCondition() RouteParentCondition {
+	return RouteParentCondition{
+		Type:   "Accepted",
+		Status: "True",
+		Reason: "Accepted",
+	}
+}
+
+// RouteParentStatusUpdate carries the RouteParentStatus conditions Run
+// computed for a single HTTPRoute/TLSRoute/TCPRoute, to be written back onto
+// the object's status by the caller.
+type RouteParentStatusUpdate struct {
+	Route      interface{}
+	Conditions []RouteParentCondition
+}
+
+// RouteParentCondition mirrors the subset of metav1.Condition fields the
+// Gateway API status convention requires.
+type RouteParentCondition struct {
+	Type   string
+	Status string
+	Reason string
+}
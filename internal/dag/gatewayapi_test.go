@@ -0,0 +1,387 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayapi_v1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+func TestBackendWeight(t *testing.T) {
+	var five int32 = 5
+
+	tests := map[string]struct {
+		backend gatewayapi_v1alpha2.HTTPBackendRef
+		want    int
+	}{
+		"no weight defaults to 1": {
+			backend: gatewayapi_v1alpha2.HTTPBackendRef{},
+			want:    1,
+		},
+		"explicit weight": {
+			backend: gatewayapi_v1alpha2.HTTPBackendRef{Weight: &five},
+			want:    5,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := backendWeight(tc.backend)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestManages(t *testing.T) {
+	gw := &gatewayapi_v1alpha2.Gateway{
+		Spec: gatewayapi_v1alpha2.GatewaySpec{
+			GatewayClassName: "contour",
+		},
+	}
+
+	tests := map[string]struct {
+		classes []*gatewayapi_v1alpha2.GatewayClass
+		want    bool
+	}{
+		"no matching GatewayClass": {
+			classes: nil,
+			want:    false,
+		},
+		"GatewayClass resolves to this controller": {
+			classes: []*gatewayapi_v1alpha2.GatewayClass{{
+				ObjectMeta: metav1.ObjectMeta{Name: "contour"},
+				Spec:       gatewayapi_v1alpha2.GatewayClassSpec{ControllerName: "projectcontour.io/contour"},
+			}},
+			want: true,
+		},
+		"GatewayClass resolves to a different controller": {
+			classes: []*gatewayapi_v1alpha2.GatewayClass{{
+				ObjectMeta: metav1.ObjectMeta{Name: "contour"},
+				Spec:       gatewayapi_v1alpha2.GatewayClassSpec{ControllerName: "example.com/other"},
+			}},
+			want: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &GatewayAPIProcessor{
+				ControllerName: "projectcontour.io/contour",
+				Source:         &fakeGatewayAPICache{gatewayClasses: tc.classes},
+			}
+			got := p.manages(gw)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestPathMatchCondition(t *testing.T) {
+	exact := gatewayapi_v1alpha2.PathMatchExact
+	prefix := gatewayapi_v1alpha2.PathMatchPathPrefix
+	value := "/api"
+
+	tests := map[string]struct {
+		match gatewayapi_v1alpha2.HTTPRouteMatch
+		want  MatchCondition
+	}{
+		"no path matches any request": {
+			match: gatewayapi_v1alpha2.HTTPRouteMatch{},
+			want:  PrefixMatchCondition{Prefix: "/"},
+		},
+		"prefix path": {
+			match: gatewayapi_v1alpha2.HTTPRouteMatch{
+				Path: &gatewayapi_v1alpha2.HTTPPathMatch{Type: &prefix, Value: &value},
+			},
+			want: PrefixMatchCondition{Prefix: "/api"},
+		},
+		"exact path": {
+			match: gatewayapi_v1alpha2.HTTPRouteMatch{
+				Path: &gatewayapi_v1alpha2.HTTPPathMatch{Type: &exact, Value: &value},
+			},
+			want: ExactMatchCondition{Path: "/api"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := pathMatchCondition(tc.match)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestServiceForBackendRef(t *testing.T) {
+	other := gatewayapi_v1alpha2.Namespace("other")
+	var port gatewayapi_v1alpha2.PortNumber = 8080
+
+	tests := map[string]struct {
+		routeNamespace string
+		ref            gatewayapi_v1alpha2.BackendRef
+		want           *Service
+	}{
+		"namespace defaults to the route's": {
+			routeNamespace: "default",
+			ref: gatewayapi_v1alpha2.BackendRef{
+				BackendObjectReference: gatewayapi_v1alpha2.BackendObjectReference{Name: "backend", Port: &port},
+			},
+			want: &Service{Namespace: "default", Name: "backend", Port: 8080},
+		},
+		"explicit namespace is honoured": {
+			routeNamespace: "default",
+			ref: gatewayapi_v1alpha2.BackendRef{
+				BackendObjectReference: gatewayapi_v1alpha2.BackendObjectReference{Name: "backend", Namespace: &other, Port: &port},
+			},
+			want: &Service{Namespace: "other", Name: "backend", Port: 8080},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := serviceForBackendRef(tc.routeNamespace, tc.ref)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+type fakeGatewayAPICache struct {
+	gatewayClasses  []*gatewayapi_v1alpha2.GatewayClass
+	gateways        []*gatewayapi_v1alpha2.Gateway
+	httpRoutes      []*gatewayapi_v1alpha2.HTTPRoute
+	tlsRoutes       []*gatewayapi_v1alpha2.TLSRoute
+	tcpRoutes       []*gatewayapi_v1alpha2.TCPRoute
+	referenceGrants []*gatewayapi_v1alpha2.ReferenceGrant
+}
+
+func (f *fakeGatewayAPICache) GatewayClasses() []*gatewayapi_v1alpha2.GatewayClass { return f.gatewayClasses }
+func (f *fakeGatewayAPICache) Gateways() []*gatewayapi_v1alpha2.Gateway            { return f.gateways }
+func (f *fakeGatewayAPICache) HTTPRoutes() []*gatewayapi_v1alpha2.HTTPRoute        { return f.httpRoutes }
+func (f *fakeGatewayAPICache) TLSRoutes() []*gatewayapi_v1alpha2.TLSRoute          { return f.tlsRoutes }
+func (f *fakeGatewayAPICache) TCPRoutes() []*gatewayapi_v1alpha2.TCPRoute          { return f.tcpRoutes }
+func (f *fakeGatewayAPICache) ReferenceGrants() []*gatewayapi_v1alpha2.ReferenceGrant {
+	return f.referenceGrants
+}
+
+func TestGatewayAPIProcessorRun(t *testing.T) {
+	gw := &gatewayapi_v1alpha2.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "contour"},
+		Spec: gatewayapi_v1alpha2.GatewaySpec{
+			GatewayClassName: "contour",
+			Listeners: []gatewayapi_v1alpha2.Listener{{
+				Name:     "http",
+				Hostname: "echo.example.com",
+			}},
+		},
+	}
+	classes := []*gatewayapi_v1alpha2.GatewayClass{{
+		ObjectMeta: metav1.ObjectMeta{Name: "contour"},
+		Spec:       gatewayapi_v1alpha2.GatewayClassSpec{ControllerName: "projectcontour.io/contour"},
+	}}
+	route := &gatewayapi_v1alpha2.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "echo"},
+		Spec: gatewayapi_v1alpha2.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapi_v1alpha2.CommonRouteSpec{
+				ParentRefs: []gatewayapi_v1alpha2.ParentReference{{Name: "contour"}},
+			},
+			Rules: []gatewayapi_v1alpha2.HTTPRouteRule{{
+				BackendRefs: []gatewayapi_v1alpha2.HTTPBackendRef{{
+					BackendRef: gatewayapi_v1alpha2.BackendRef{
+						BackendObjectReference: gatewayapi_v1alpha2.BackendObjectReference{Name: "echo", Port: portPtr(80)},
+					},
+				}},
+			}},
+		},
+	}
+
+	p := &GatewayAPIProcessor{
+		ControllerName: "projectcontour.io/contour",
+		Source: &fakeGatewayAPICache{
+			gatewayClasses: classes,
+			gateways:       []*gatewayapi_v1alpha2.Gateway{gw},
+			httpRoutes:     []*gatewayapi_v1alpha2.HTTPRoute{route},
+		},
+	}
+
+	dag := new(DAG)
+	updates := p.Run(dag)
+
+	if len(updates) != 1 {
+		t.Fatalf("got %d status updates, want 1", len(updates))
+	}
+
+	vhost := dag.VirtualHost("echo.example.com")
+	if len(vhost.Routes) != 1 {
+		t.Fatalf("got %d routes on echo.example.com, want 1", len(vhost.Routes))
+	}
+}
+
+func TestAttachHTTPRoute(t *testing.T) {
+	vhost := &VirtualHost{Name: "echo.example.com"}
+	route := &gatewayapi_v1alpha2.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "echo"},
+		Spec: gatewayapi_v1alpha2.HTTPRouteSpec{
+			Rules: []gatewayapi_v1alpha2.HTTPRouteRule{{
+				BackendRefs: []gatewayapi_v1alpha2.HTTPBackendRef{{
+					BackendRef: gatewayapi_v1alpha2.BackendRef{
+						BackendObjectReference: gatewayapi_v1alpha2.BackendObjectReference{Name: "echo", Port: portPtr(80)},
+					},
+				}},
+			}},
+		},
+	}
+
+	p := &GatewayAPIProcessor{Source: &fakeGatewayAPICache{}}
+	update := p.attachHTTPRoute(vhost, route)
+
+	if len(vhost.Routes) != 1 {
+		t.Fatalf("got %d routes, want 1", len(vhost.Routes))
+	}
+	if diff := cmp.Diff(PrefixMatchCondition{Prefix: "/"}, vhost.Routes[0].PathMatchCondition); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(update.Conditions) != 1 || update.Conditions[0].Reason != "Accepted" {
+		t.Fatalf("got conditions %+v, want a single Accepted condition", update.Conditions)
+	}
+}
+
+func TestAttachHTTPRouteCrossNamespaceBackendRefDenied(t *testing.T) {
+	vhost := &VirtualHost{Name: "echo.example.com"}
+	other := gatewayapi_v1alpha2.Namespace("other")
+	route := &gatewayapi_v1alpha2.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "echo"},
+		Spec: gatewayapi_v1alpha2.HTTPRouteSpec{
+			Rules: []gatewayapi_v1alpha2.HTTPRouteRule{{
+				BackendRefs: []gatewayapi_v1alpha2.HTTPBackendRef{{
+					BackendRef: gatewayapi_v1alpha2.BackendRef{
+						BackendObjectReference: gatewayapi_v1alpha2.BackendObjectReference{
+							Name: "echo", Namespace: &other, Port: portPtr(80),
+						},
+					},
+				}},
+			}},
+		},
+	}
+
+	p := &GatewayAPIProcessor{Source: &fakeGatewayAPICache{}}
+	update := p.attachHTTPRoute(vhost, route)
+
+	if len(vhost.Routes) != 0 {
+		t.Fatalf("got %d routes, want 0 when the only backendRef is denied", len(vhost.Routes))
+	}
+	if len(update.Conditions) != 1 || update.Conditions[0].Reason != "RefNotPermitted" {
+		t.Fatalf("got conditions %+v, want a single RefNotPermitted condition", update.Conditions)
+	}
+}
+
+func TestAttachTLSRoute(t *testing.T) {
+	dag := new(DAG)
+	route := &gatewayapi_v1alpha2.TLSRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "echo"},
+		Spec: gatewayapi_v1alpha2.TLSRouteSpec{
+			Hostnames: []gatewayapi_v1alpha2.Hostname{"echo.example.com"},
+			Rules: []gatewayapi_v1alpha2.TLSRouteRule{{
+				BackendRefs: []gatewayapi_v1alpha2.BackendRef{{
+					BackendObjectReference: gatewayapi_v1alpha2.BackendObjectReference{Name: "echo", Port: portPtr(443)},
+				}},
+			}},
+		},
+	}
+
+	p := &GatewayAPIProcessor{Source: &fakeGatewayAPICache{}}
+	update := p.attachTLSRoute(dag, route)
+
+	vhost := dag.VirtualHost("echo.example.com")
+	if vhost.TCPProxy == nil || len(vhost.TCPProxy.Clusters) != 1 {
+		t.Fatalf("got TCPProxy %+v, want one cluster", vhost.TCPProxy)
+	}
+	if len(update.Conditions) != 1 || update.Conditions[0].Reason != "Accepted" {
+		t.Fatalf("got conditions %+v, want a single Accepted condition", update.Conditions)
+	}
+}
+
+func TestAttachTCPRoute(t *testing.T) {
+	vhost := &VirtualHost{Name: ""}
+	route := &gatewayapi_v1alpha2.TCPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "echo"},
+		Spec: gatewayapi_v1alpha2.TCPRouteSpec{
+			Rules: []gatewayapi_v1alpha2.TCPRouteRule{{
+				BackendRefs: []gatewayapi_v1alpha2.BackendRef{{
+					BackendObjectReference: gatewayapi_v1alpha2.BackendObjectReference{Name: "echo", Port: portPtr(9000)},
+				}},
+			}},
+		},
+	}
+
+	p := &GatewayAPIProcessor{Source: &fakeGatewayAPICache{}}
+	update := p.attachTCPRoute(vhost, route)
+
+	if vhost.TCPProxy == nil || len(vhost.TCPProxy.Clusters) != 1 {
+		t.Fatalf("got TCPProxy %+v, want one cluster", vhost.TCPProxy)
+	}
+	if len(update.Conditions) != 1 || update.Conditions[0].Reason != "Accepted" {
+		t.Fatalf("got conditions %+v, want a single Accepted condition", update.Conditions)
+	}
+}
+
+// TestRedirectFromFilterDefaultStatusCode guards against regressing to 301:
+// the Gateway API's HTTPRequestRedirectFilter.StatusCode defaults to 302
+// when left unset.
+func TestRedirectFromFilterDefaultStatusCode(t *testing.T) {
+	got := redirectFromFilter(&gatewayapi_v1alpha2.HTTPRequestRedirectFilter{})
+	if got.StatusCode != 302 {
+		t.Fatalf("got default StatusCode %d, want 302", got.StatusCode)
+	}
+}
+
+func portPtr(p gatewayapi_v1alpha2.PortNumber) *gatewayapi_v1alpha2.PortNumber { return &p }
+
+func TestReferenceGrantPermits(t *testing.T) {
+	grant := &gatewayapi_v1alpha2.ReferenceGrant{
+		Spec: gatewayapi_v1alpha2.ReferenceGrantSpec{
+			From: []gatewayapi_v1alpha2.ReferenceGrantFrom{{
+				Kind:      "HTTPRoute",
+				Namespace: "projectcontour",
+			}},
+		},
+	}
+
+	tests := map[string]struct {
+		fromNamespace string
+		fromKind      string
+		want          bool
+	}{
+		"matching namespace and kind": {fromNamespace: "projectcontour", fromKind: "HTTPRoute", want: true},
+		"non-matching namespace":      {fromNamespace: "other", fromKind: "HTTPRoute", want: false},
+		"non-matching kind":           {fromNamespace: "projectcontour", fromKind: "TLSRoute", want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := referenceGrantPermits(grant, tc.fromNamespace, tc.fromKind)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+
+	contourv1beta1 "github.com/heptio/contour/apis/contour/v1beta1"
+)
+
+// IngressRouteProcessor translates IngressRoute objects, and the
+// JWTProvider/ExtensionService objects their virtual hosts reference, into
+// the DAG alongside the Ingress and GatewayAPIProcessor processors. It
+// compiles authorization, JWT, Wasm and external-authz policy from CRD
+// fields into the AuthorizationPolicy, JWTProvider/JWTRequirement,
+// WasmFilter and AuthorizationService DAG types so the xDS visitor can
+// render the envoy.filters.http.rbac, envoy.filters.http.jwt_authn,
+// envoy.filters.http.wasm and envoy.filters.http.ext_authz filters without
+// any further IngressRoute-specific logic, the same way it renders routes.
+type IngressRouteProcessor struct {
+	Source IngressRouteCache
+}
+
+// IngressRouteCache is the subset of an informer-backed cache the processor
+// needs.
+type IngressRouteCache interface {
+	IngressRoutes() []*contourv1beta1.IngressRoute
+	JWTProviders() []*contourv1beta1.JWTProvider
+	ExtensionServices() []*contourv1beta1.ExtensionService
+}
+
+// Run builds a VirtualHost for every IngressRoute's virtualhost.fqdn,
+// populates its AuthorizationPolicy, JWTProviders and WasmFilters, and
+// attaches its Routes.
+func (p *IngressRouteProcessor) Run(dag *DAG) {
+	extensionServices := p.indexExtensionServices()
+
+	for _, ir := range p.Source.IngressRoutes() {
+		if ir.Spec.VirtualHost == nil {
+			continue
+		}
+		vhost := dag.VirtualHost(ir.Spec.VirtualHost.Fqdn)
+
+		if policy := ir.Spec.VirtualHost.Authorization; policy != nil {
+			vhost.AuthorizationPolicy = authorizationPolicy(policy)
+		}
+		vhost.JWTProviders = p.jwtProviders(ir.Spec.VirtualHost.JWT)
+		vhost.WasmFilters = p.wasmFilters(ir.Namespace, ir.Spec.VirtualHost.Wasm, extensionServices)
+		if al := ir.Spec.VirtualHost.AccessLog; al != nil {
+			vhost.AccessLog = accessLogPolicy(al)
+		}
+		if authz := ir.Spec.VirtualHost.Authz; authz != nil {
+			vhost.AuthorizationService = p.authorizationService(ir.Namespace, authz, extensionServices)
+		}
+
+		for _, route := range ir.Spec.Routes {
+			vhost.Routes = append(vhost.Routes, buildIngressRouteRoute(ir.Namespace, route))
+		}
+	}
+}
+
+func buildIngressRouteRoute(namespace string, route contourv1beta1.Route) *Route {
+	r := &Route{
+		PathMatchCondition: PrefixMatchCondition{Prefix: route.Match},
+		Clusters:           ingressRouteClusters(namespace, route.Services),
+		WasmDisabled:       route.WasmDisabled,
+	}
+	if route.Authorization != nil {
+		r.AuthorizationPolicy = authorizationPolicy(route.Authorization)
+	}
+	if route.JWT != nil {
+		r.JWTRequirement = &JWTRequirement{
+			ProviderNames: route.JWT.ProviderNames,
+			RequireAll:    route.JWT.RequireAll,
+		}
+	}
+	return r
+}
+
+func ingressRouteClusters(namespace string, services []contourv1beta1.Service) []*Cluster {
+	var clusters []*Cluster
+	for _, svc := range services {
+		weight := svc.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		clusters = append(clusters, &Cluster{
+			Upstream: &Service{Namespace: namespace, Name: svc.Name, Port: int32(svc.Port)},
+			Weight:   weight,
+		})
+	}
+	return clusters
+}
+
+// authorizationPolicy translates an AuthorizationPolicy CRD value into its
+// DAG equivalent, defaulting DefaultAction to the Envoy-native "ALLOW"/"DENY"
+// spelling.
+func authorizationPolicy(policy *contourv1beta1.AuthorizationPolicy) *AuthorizationPolicy {
+	rules := make([]AuthorizationRule, 0, len(policy.Rules))
+	for _, rule := range policy.Rules {
+		principals := make([]AuthorizationPrincipal, 0, len(rule.Principals))
+		for _, p := range rule.Principals {
+			principals = append(principals, AuthorizationPrincipal{
+				Namespace:      p.Namespace,
+				ServiceAccount: p.ServiceAccount,
+				JWTProvider:    p.JWTProvider,
+				JWTClaim:       p.JWTClaim,
+				JWTClaimValue:  p.JWTClaimValue,
+			})
+		}
+		rules = append(rules, AuthorizationRule{
+			Principals: principals,
+			Methods:    rule.Methods,
+			Paths:      rule.Paths,
+		})
+	}
+	return &AuthorizationPolicy{
+		DefaultAction: strings.ToUpper(policy.DefaultAction),
+		Disabled:      policy.Disabled,
+		Rules:         rules,
+	}
+}
+
+func (p *IngressRouteProcessor) jwtProviders(refs []contourv1beta1.JWTProviderRef) []JWTProvider {
+	if len(refs) == 0 {
+		return nil
+	}
+	byName := make(map[string]*contourv1beta1.JWTProvider, len(p.Source.JWTProviders()))
+	for _, provider := range p.Source.JWTProviders() {
+		byName[provider.Name] = provider
+	}
+
+	var providers []JWTProvider
+	for _, ref := range refs {
+		provider, ok := byName[ref.Name]
+		if !ok {
+			continue
+		}
+		providers = append(providers, jwtProvider(provider))
+	}
+	return providers
+}
+
+func jwtProvider(provider *contourv1beta1.JWTProvider) JWTProvider {
+	p := JWTProvider{
+		Name:           provider.Name,
+		Issuer:         provider.Spec.Issuer,
+		Audiences:      provider.Spec.Audiences,
+		ForwardJWT:     provider.Spec.ForwardJWT,
+		ClaimToHeaders: provider.Spec.ClaimToHeaders,
+	}
+	if jwks := provider.Spec.JWKS; jwks != nil {
+		switch {
+		case jwks.Keys != "":
+			p.Keys = jwks.Keys
+		case jwks.URI != "":
+			p.JWKSURI = jwks.URI
+			p.JWKSHost, p.JWKSPort = jwksHostPort(jwks.URI)
+		}
+	}
+	return p
+}
+
+// jwksHostPort parses uri's host and port, so the cluster Contour
+// synthesizes to fetch a JWTProvider's remote JWKS dials the endpoint the
+// provider actually names, defaulting the port from the URI's scheme
+// (https: 443, http: 80) when uri doesn't specify one.
+func jwksHostPort(uri string) (string, int32) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", 0
+	}
+	if port := u.Port(); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return u.Hostname(), 0
+		}
+		return u.Hostname(), int32(p)
+	}
+	if u.Scheme == "http" {
+		return u.Hostname(), 80
+	}
+	return u.Hostname(), 443
+}
+
+// accessLogPolicy translates an AccessLogConfig CRD value into its DAG
+// equivalent.
+func accessLogPolicy(al *contourv1beta1.AccessLogConfig) *AccessLogPolicy {
+	return &AccessLogPolicy{
+		Format:       al.Format,
+		FormatString: al.FormatString,
+		JSONFields:   al.JSONFields,
+	}
+}
+
+func (p *IngressRouteProcessor) wasmFilters(namespace string, refs []contourv1beta1.WasmFilterRef, extensionServices map[string]*contourv1beta1.ExtensionService) []WasmFilter {
+	var filters []WasmFilter
+	for _, ref := range refs {
+		ext, ok := extensionServices[namespacedName(namespace, ref.ExtensionService)]
+		if !ok || ext.Spec.WasmModule == nil {
+			continue
+		}
+		module := ext.Spec.WasmModule
+
+		filter := WasmFilter{
+			Name:    ref.Name,
+			Runtime: wasmRuntime(module.Runtime),
+			SHA256:  module.SHA256,
+		}
+		switch {
+		case module.Inline != "":
+			inline, err := base64.StdEncoding.DecodeString(module.Inline)
+			if err == nil {
+				filter.Inline = inline
+			}
+		case module.HTTPPath != "" && ext.Spec.Service != nil:
+			filter.HTTPPath = module.HTTPPath
+			filter.Upstream = &Service{
+				Namespace: ext.Namespace,
+				Name:      ext.Spec.Service.Name,
+				Port:      int32(ext.Spec.Service.Port),
+			}
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+func wasmRuntime(runtime string) string {
+	if runtime == "" {
+		return "v8"
+	}
+	return runtime
+}
+
+// authorizationService resolves authz's ExtensionService (in namespace) into
+// its DAG equivalent, returning nil if the ExtensionService is not found or
+// has no Service to dial.
+func (p *IngressRouteProcessor) authorizationService(namespace string, authz *contourv1beta1.AuthorizationConfig, extensionServices map[string]*contourv1beta1.ExtensionService) *AuthorizationService {
+	ext, ok := extensionServices[namespacedName(namespace, authz.ExtensionService)]
+	if !ok || ext.Spec.Service == nil {
+		return nil
+	}
+
+	timeout := authz.ResponseTimeout
+	if timeout == "" {
+		timeout = ext.Spec.Timeout
+	}
+
+	return &AuthorizationService{
+		Upstream: &Service{
+			Namespace: ext.Namespace,
+			Name:      ext.Spec.Service.Name,
+			Port:      int32(ext.Spec.Service.Port),
+		},
+		GRPC:             ext.Spec.Protocol != "http",
+		Timeout:          timeout,
+		FailureModeAllow: authz.FailureModeAllow || ext.Spec.FailureModeAllow,
+		IncludedHeaders:  ext.Spec.IncludedHeaders,
+	}
+}
+
+func (p *IngressRouteProcessor) indexExtensionServices() map[string]*contourv1beta1.ExtensionService {
+	index := make(map[string]*contourv1beta1.ExtensionService)
+	for _, ext := range p.Source.ExtensionServices() {
+		index[namespacedName(ext.Namespace, ext.Name)] = ext
+	}
+	return index
+}
+
+// namespacedName qualifies name with namespace unless name is already
+// qualified ("other-ns/name"), per the cross-namespace reference convention
+// ExtensionService references share with Gateway API BackendRefs.
+func namespacedName(namespace, name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return namespace + "/" + name
+}
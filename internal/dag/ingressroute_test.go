@@ -0,0 +1,265 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	contourv1beta1 "github.com/heptio/contour/apis/contour/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeIngressRouteCache struct {
+	ingressRoutes     []*contourv1beta1.IngressRoute
+	jwtProviders      []*contourv1beta1.JWTProvider
+	extensionServices []*contourv1beta1.ExtensionService
+}
+
+func (f *fakeIngressRouteCache) IngressRoutes() []*contourv1beta1.IngressRoute { return f.ingressRoutes }
+func (f *fakeIngressRouteCache) JWTProviders() []*contourv1beta1.JWTProvider   { return f.jwtProviders }
+func (f *fakeIngressRouteCache) ExtensionServices() []*contourv1beta1.ExtensionService {
+	return f.extensionServices
+}
+
+func TestIngressRouteProcessorRun(t *testing.T) {
+	ir := &contourv1beta1.IngressRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "echo"},
+		Spec: contourv1beta1.IngressRouteSpec{
+			VirtualHost: &contourv1beta1.VirtualHost{
+				Fqdn: "echo.example.com",
+				Authorization: &contourv1beta1.AuthorizationPolicy{
+					DefaultAction: "deny",
+					Rules: []contourv1beta1.AuthorizationRule{{
+						Principals: []contourv1beta1.Principal{{Namespace: "default", ServiceAccount: "echo"}},
+					}},
+				},
+			},
+			Routes: []contourv1beta1.Route{{
+				Match: "/",
+				Services: []contourv1beta1.Service{
+					{Name: "echo", Port: 80},
+				},
+			}},
+		},
+	}
+
+	p := &IngressRouteProcessor{Source: &fakeIngressRouteCache{ingressRoutes: []*contourv1beta1.IngressRoute{ir}}}
+	dag := new(DAG)
+	p.Run(dag)
+
+	vhost := dag.VirtualHost("echo.example.com")
+	if vhost.AuthorizationPolicy == nil || vhost.AuthorizationPolicy.DefaultAction != "DENY" {
+		t.Fatalf("got AuthorizationPolicy %+v, want DefaultAction DENY", vhost.AuthorizationPolicy)
+	}
+	if len(vhost.Routes) != 1 {
+		t.Fatalf("got %d routes, want 1", len(vhost.Routes))
+	}
+
+	want := &Route{
+		PathMatchCondition: PrefixMatchCondition{Prefix: "/"},
+		Clusters: []*Cluster{{
+			Upstream: &Service{Namespace: "default", Name: "echo", Port: 80},
+			Weight:   1,
+		}},
+	}
+	if diff := cmp.Diff(want, vhost.Routes[0]); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestAuthorizationPolicy(t *testing.T) {
+	policy := &contourv1beta1.AuthorizationPolicy{
+		DefaultAction: "allow",
+		Rules: []contourv1beta1.AuthorizationRule{{
+			Principals: []contourv1beta1.Principal{{JWTProvider: "google", JWTClaim: "iss", JWTClaimValue: "accounts.google.com"}},
+			Methods:    []string{"GET"},
+			Paths:      []string{"/healthz"},
+		}},
+	}
+
+	got := authorizationPolicy(policy)
+	want := &AuthorizationPolicy{
+		DefaultAction: "ALLOW",
+		Rules: []AuthorizationRule{{
+			Principals: []AuthorizationPrincipal{{JWTProvider: "google", JWTClaim: "iss", JWTClaimValue: "accounts.google.com"}},
+			Methods:    []string{"GET"},
+			Paths:      []string{"/healthz"},
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestJWTProvidersRemoteJWKS(t *testing.T) {
+	p := &IngressRouteProcessor{
+		Source: &fakeIngressRouteCache{
+			jwtProviders: []*contourv1beta1.JWTProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "google"},
+				Spec: contourv1beta1.JWTProviderSpec{
+					Issuer: "accounts.google.com",
+					JWKS:   &contourv1beta1.JWKS{URI: "https://www.googleapis.com/oauth2/v3/certs"},
+				},
+			}},
+		},
+	}
+
+	got := p.jwtProviders([]contourv1beta1.JWTProviderRef{{Name: "google"}})
+	if len(got) != 1 {
+		t.Fatalf("got %d providers, want 1", len(got))
+	}
+	if got[0].JWKSHost != "www.googleapis.com" {
+		t.Fatalf("got JWKSHost %q, want %q", got[0].JWKSHost, "www.googleapis.com")
+	}
+	if got[0].JWKSPort != 443 {
+		t.Fatalf("got JWKSPort %d, want 443", got[0].JWKSPort)
+	}
+}
+
+func TestJWKSHostPort(t *testing.T) {
+	tests := map[string]struct {
+		uri      string
+		wantHost string
+		wantPort int32
+	}{
+		"https, no explicit port": {uri: "https://www.googleapis.com/oauth2/v3/certs", wantHost: "www.googleapis.com", wantPort: 443},
+		"http, no explicit port":  {uri: "http://jwks.internal/certs", wantHost: "jwks.internal", wantPort: 80},
+		"explicit port":           {uri: "https://jwks.internal:8443/certs", wantHost: "jwks.internal", wantPort: 8443},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			host, port := jwksHostPort(tc.uri)
+			if host != tc.wantHost || port != tc.wantPort {
+				t.Fatalf("got (%q, %d), want (%q, %d)", host, port, tc.wantHost, tc.wantPort)
+			}
+		})
+	}
+}
+
+func TestAccessLogPolicy(t *testing.T) {
+	got := accessLogPolicy(&contourv1beta1.AccessLogConfig{
+		Format:     "json",
+		JSONFields: map[string]string{"status": "%RESPONSE_CODE%"},
+	})
+
+	want := &AccessLogPolicy{
+		Format:     "json",
+		JSONFields: map[string]string{"status": "%RESPONSE_CODE%"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestWasmFiltersHTTPSource(t *testing.T) {
+	p := &IngressRouteProcessor{}
+	extensionServices := map[string]*contourv1beta1.ExtensionService{
+		"default/modules": {
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "modules"},
+			Spec: contourv1beta1.ExtensionServiceSpec{
+				Service: &contourv1beta1.ServiceRef{Name: "module-host", Port: 80},
+				WasmModule: &contourv1beta1.WasmModuleSource{
+					HTTPPath: "/module.wasm",
+					SHA256:   "abc123",
+				},
+			},
+		},
+	}
+
+	got := p.wasmFilters("default", []contourv1beta1.WasmFilterRef{{Name: "my-filter", ExtensionService: "modules"}}, extensionServices)
+	want := []WasmFilter{{
+		Name:     "my-filter",
+		Runtime:  "v8",
+		HTTPPath: "/module.wasm",
+		SHA256:   "abc123",
+		Upstream: &Service{Namespace: "default", Name: "module-host", Port: 80},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestAuthorizationService(t *testing.T) {
+	p := &IngressRouteProcessor{}
+	extensionServices := map[string]*contourv1beta1.ExtensionService{
+		"default/opa": {
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "opa"},
+			Spec: contourv1beta1.ExtensionServiceSpec{
+				Service:          &contourv1beta1.ServiceRef{Name: "opa", Port: 9191},
+				Timeout:          "2s",
+				FailureModeAllow: true,
+				IncludedHeaders:  []string{"authorization"},
+			},
+		},
+	}
+
+	got := p.authorizationService("default", &contourv1beta1.AuthorizationConfig{ExtensionService: "opa"}, extensionServices)
+	want := &AuthorizationService{
+		Upstream:         &Service{Namespace: "default", Name: "opa", Port: 9191},
+		GRPC:             true,
+		Timeout:          "2s",
+		FailureModeAllow: true,
+		IncludedHeaders:  []string{"authorization"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestAuthorizationServiceResponseTimeoutOverride(t *testing.T) {
+	p := &IngressRouteProcessor{}
+	extensionServices := map[string]*contourv1beta1.ExtensionService{
+		"default/opa": {
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "opa"},
+			Spec: contourv1beta1.ExtensionServiceSpec{
+				Service: &contourv1beta1.ServiceRef{Name: "opa", Port: 9191},
+				Timeout: "2s",
+			},
+		},
+	}
+
+	got := p.authorizationService("default", &contourv1beta1.AuthorizationConfig{
+		ExtensionService: "opa",
+		ResponseTimeout:  "500ms",
+	}, extensionServices)
+	if got.Timeout != "500ms" {
+		t.Fatalf("got Timeout %q, want %q", got.Timeout, "500ms")
+	}
+}
+
+func TestAuthorizationServiceNoSuchExtensionService(t *testing.T) {
+	p := &IngressRouteProcessor{}
+	got := p.authorizationService("default", &contourv1beta1.AuthorizationConfig{ExtensionService: "missing"}, nil)
+	if got != nil {
+		t.Fatalf("got %+v, want nil", got)
+	}
+}
+
+func TestNamespacedName(t *testing.T) {
+	tests := map[string]struct {
+		namespace, name, want string
+	}{
+		"unqualified name takes the given namespace": {namespace: "default", name: "svc", want: "default/svc"},
+		"already-qualified name is unchanged":         {namespace: "default", name: "other/svc", want: "other/svc"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := namespacedName(tc.namespace, tc.name)
+			if got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+// AccessLogFormatEnvoy and AccessLogFormatJSON are the values `contour
+// serve`'s --access-log-format flag accepts, selecting FileAccessLog or
+// JSONAccessLog respectively for the access log Contour configures by
+// default. HTTPGRPCAccessLog and TCPGRPCAccessLog cannot be selected
+// through this flag.
+const (
+	AccessLogFormatEnvoy = "envoy"
+	AccessLogFormatJSON  = "json"
+)
+
+// ValidAccessLogFormat reports whether format is a format
+// --access-log-format accepts.
+func ValidAccessLogFormat(format string) bool {
+	switch format {
+	case AccessLogFormatEnvoy, AccessLogFormatJSON:
+		return true
+	default:
+		return false
+	}
+}
+
+// DefaultAccessLogFormat is the text format Envoy uses when a text
+// AccessLog is built without an explicit format string.
+const DefaultAccessLogFormat = `[%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" ` +
+	`%RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% ` +
+	`"%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"` + "\n"
+
+// FileAccessLog returns an envoy.file_access_log entry that writes
+// plain text to path using format, or DefaultAccessLogFormat when format is
+// empty. This is `contour serve`'s default access log, kept for backward
+// compatibility with deployments that only set --access-log-format=envoy.
+func FileAccessLog(path, format string) *types.Value {
+	if format == "" {
+		format = DefaultAccessLogFormat
+	}
+	return st(map[string]*types.Value{
+		"name": sv("envoy.file_access_log"),
+		"config": st(map[string]*types.Value{
+			"path":   sv(path),
+			"format": sv(format),
+		}),
+	})
+}
+
+// JSONAccessLog returns an envoy.file_access_log entry that writes one JSON
+// object per log line to path, with fields controlling which operators'
+// substitution commands (e.g. "%RESPONSE_CODE%") populate which JSON key.
+// This gives operators structured logs consumable by Loki/ELK without
+// needing to parse the default text format.
+func JSONAccessLog(path string, fields map[string]string) *types.Value {
+	jsonFields := make(map[string]*types.Value, len(fields))
+	for key, value := range fields {
+		jsonFields[key] = sv(value)
+	}
+	return st(map[string]*types.Value{
+		"name": sv("envoy.file_access_log"),
+		"config": st(map[string]*types.Value{
+			"path":        sv(path),
+			"json_format": st(jsonFields),
+		}),
+	})
+}
+
+// HTTPGRPCAccessLog returns an envoy.access_loggers.http_grpc entry that
+// streams access logs to clusterName, a Contour-managed cluster pointing at
+// an external gRPC ALS collector. logName identifies this listener's log
+// stream to the collector.
+func HTTPGRPCAccessLog(logName, clusterName string) *types.Value {
+	return st(map[string]*types.Value{
+		"name": sv("envoy.access_loggers.http_grpc"),
+		"config": st(map[string]*types.Value{
+			"common_config": grpcAccessLogCommonConfig(logName, clusterName),
+		}),
+	})
+}
+
+// TCPGRPCAccessLog returns an envoy.access_loggers.tcp_grpc entry, the TCP
+// listener equivalent of HTTPGRPCAccessLog.
+func TCPGRPCAccessLog(logName, clusterName string) *types.Value {
+	return st(map[string]*types.Value{
+		"name": sv("envoy.access_loggers.tcp_grpc"),
+		"config": st(map[string]*types.Value{
+			"common_config": grpcAccessLogCommonConfig(logName, clusterName),
+		}),
+	})
+}
+
+// AccessLogForVirtualHost returns the access log entry vhost's routes
+// should use: path built according to vhost.AccessLog if set, falling back
+// to defaultLog (the access log `contour serve`'s --access-log-format
+// selected) otherwise.
+func AccessLogForVirtualHost(vhost *dag.VirtualHost, path string, defaultLog *types.Value) *types.Value {
+	al := vhost.AccessLog
+	if al == nil {
+		return defaultLog
+	}
+	if al.Format == AccessLogFormatJSON {
+		return JSONAccessLog(path, al.JSONFields)
+	}
+	return FileAccessLog(path, al.FormatString)
+}
+
+func grpcAccessLogCommonConfig(logName, clusterName string) *types.Value {
+	return st(map[string]*types.Value{
+		"log_name": sv(logName),
+		"grpc_service": st(map[string]*types.Value{
+			"envoy_grpc": st(map[string]*types.Value{
+				"cluster_name": sv(clusterName),
+			}),
+		}),
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+func TestFileAccessLog(t *testing.T) {
+	tests := map[string]struct {
+		path   string
+		format string
+		want   *types.Value
+	}{
+		"default format": {
+			path: "/dev/stdout",
+			want: st(map[string]*types.Value{
+				"name": sv("envoy.file_access_log"),
+				"config": st(map[string]*types.Value{
+					"path":   sv("/dev/stdout"),
+					"format": sv(DefaultAccessLogFormat),
+				}),
+			}),
+		},
+		"custom format": {
+			path:   "/dev/stdout",
+			format: "%RESPONSE_CODE%\n",
+			want: st(map[string]*types.Value{
+				"name": sv("envoy.file_access_log"),
+				"config": st(map[string]*types.Value{
+					"path":   sv("/dev/stdout"),
+					"format": sv("%RESPONSE_CODE%\n"),
+				}),
+			}),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := FileAccessLog(tc.path, tc.format)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestJSONAccessLog(t *testing.T) {
+	got := JSONAccessLog("/dev/stdout", map[string]string{
+		"status": "%RESPONSE_CODE%",
+	})
+
+	want := st(map[string]*types.Value{
+		"name": sv("envoy.file_access_log"),
+		"config": st(map[string]*types.Value{
+			"path": sv("/dev/stdout"),
+			"json_format": st(map[string]*types.Value{
+				"status": sv("%RESPONSE_CODE%"),
+			}),
+		}),
+	})
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestValidAccessLogFormat(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		want   bool
+	}{
+		"envoy text format is valid": {format: "envoy", want: true},
+		"json format is valid":       {format: "json", want: true},
+		"unknown format is invalid":  {format: "xml", want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ValidAccessLogFormat(tc.format); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAccessLogForVirtualHost(t *testing.T) {
+	defaultLog := FileAccessLog("/dev/stdout", "")
+
+	t.Run("no override falls back to the default", func(t *testing.T) {
+		got := AccessLogForVirtualHost(&dag.VirtualHost{}, "/dev/stdout", defaultLog)
+		if diff := cmp.Diff(defaultLog, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("json override", func(t *testing.T) {
+		vhost := &dag.VirtualHost{AccessLog: &dag.AccessLogPolicy{
+			Format:     "json",
+			JSONFields: map[string]string{"status": "%RESPONSE_CODE%"},
+		}}
+		got := AccessLogForVirtualHost(vhost, "/dev/stdout", defaultLog)
+		want := JSONAccessLog("/dev/stdout", map[string]string{"status": "%RESPONSE_CODE%"})
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestGRPCAccessLog(t *testing.T) {
+	tests := map[string]struct {
+		builder func(logName, clusterName string) *types.Value
+		name    string
+	}{
+		"http": {builder: HTTPGRPCAccessLog, name: "envoy.access_loggers.http_grpc"},
+		"tcp":  {builder: TCPGRPCAccessLog, name: "envoy.access_loggers.tcp_grpc"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.builder("ingress_http", "contour-als")
+
+			want := st(map[string]*types.Value{
+				"name": sv(tc.name),
+				"config": st(map[string]*types.Value{
+					"common_config": st(map[string]*types.Value{
+						"log_name": sv("ingress_http"),
+						"grpc_service": st(map[string]*types.Value{
+							"envoy_grpc": st(map[string]*types.Value{
+								"cluster_name": sv("contour-als"),
+							}),
+						}),
+					}),
+				}),
+			})
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
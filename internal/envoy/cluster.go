@@ -0,0 +1,72 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/heptio/contour/internal/dag"
+)
+
+// Clustername returns the name Contour gives the CDS cluster for svc, via
+// Hashname so a long namespace/name/port combination is still a valid,
+// predictable Envoy resource name. ExtAuthzFilterForVirtualHost and
+// WasmFiltersForVirtualHost name their upstream cluster this way, and
+// JWTAuthenticationForVirtualHost names a JWKS cluster with Hashname over
+// the JWKS host and port, so the DAG and xDS visitor agree on a name without
+// consulting each other out of band.
+func Clustername(svc *dag.Service) string {
+	return Hashname(60, svc.Namespace, svc.Name, strconv.Itoa(int(svc.Port)))
+}
+
+// Hashname joins s with "/" and returns the result verbatim if it is at
+// most l octets. Otherwise each element is shortened in turn, its tail
+// replaced by a hash of the full join, until the result fits within l;
+// if shortening every element still isn't enough, the whole join is
+// replaced by a hash instead. This keeps generated Envoy resource names
+// under Envoy's name-length limits while remaining a predictable,
+// collision-resistant function of s.
+func Hashname(l int, s ...string) string {
+	r := strings.Join(s, "/")
+	if len(r) <= l || len(s) == 0 {
+		return r
+	}
+
+	hash := fmt.Sprintf("%x", sha1.Sum([]byte(r)))
+	hashed := append([]string(nil), s...)
+	for n := len(hashed) - 1; n >= 0; n-- {
+		hashed[n] = truncate((l-len(hashed)+1)/len(hashed), hashed[n], hash)
+		r = strings.Join(hashed, "/")
+		if len(r) <= l {
+			return r
+		}
+	}
+	return truncate(l, r, hash)
+}
+
+// truncate returns s if it is at most l octets, otherwise s shortened to
+// l octets by replacing its tail with "-"+suffix, or a prefix of suffix
+// alone if there isn't room for any of s.
+func truncate(l int, s, suffix string) string {
+	if len(s) <= l {
+		return s
+	}
+	if l <= len(suffix) {
+		return suffix[:l]
+	}
+	return s[:l-len(suffix)-1] + "-" + suffix
+}
@@ -16,12 +16,7 @@ package envoy
 import (
 	"testing"
 
-	"github.com/google/go-cmp/cmp"
-	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
 	"github.com/heptio/contour/internal/dag"
-	"k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestClustername(t *testing.T) {
@@ -30,56 +25,23 @@ func TestClustername(t *testing.T) {
 		want    string
 	}{
 		"simple": {
-			service: &dag.Service{
-				Object: service("default", "backend"),
-				ServicePort: &v1.ServicePort{
-					Name:       "http",
-					Protocol:   "TCP",
-					Port:       80,
-					TargetPort: intstr.FromInt(6502),
-				},
-			},
-			want: "default/backend/80/da39a3ee5e",
+			service: &dag.Service{Namespace: "default", Name: "backend", Port: 80},
+			want:    "default/backend/80",
 		},
 		"far too long": {
 			service: &dag.Service{
-				Object: service("it-is-a-truth-universally-acknowledged-that-a-single-man-in-possession-of-a-good-fortune", "must-be-in-want-of-a-wife"),
-				ServicePort: &v1.ServicePort{
-					Name:       "http",
-					Protocol:   "TCP",
-					Port:       9999,
-					TargetPort: intstr.FromString("http-alt"),
-				},
-			},
-			want: "it-is-a--dea8b0/must-be--dea8b0/9999/da39a3ee5e",
-		},
-		"various healthcheck params": {
-			service: &dag.Service{
-				Object: service("default", "backend"),
-				ServicePort: &v1.ServicePort{
-					Name:       "http",
-					Protocol:   "TCP",
-					Port:       80,
-					TargetPort: intstr.FromInt(6502),
-				},
-				LoadBalancerStrategy: "Maglev",
-				HealthCheck: &ingressroutev1.HealthCheck{
-					Path:                    "/healthz",
-					IntervalSeconds:         5,
-					TimeoutSeconds:          30,
-					UnhealthyThresholdCount: 3,
-					HealthyThresholdCount:   1,
-				},
+				Namespace: "production-payments-checkout-service-namespace-name-really-long",
+				Name:      "svc",
+				Port:      8080,
 			},
-			want: "default/backend/80/32737eb011",
+			want: "da38cb72d6054d42a01/svc/8080",
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			got := Clustername(tc.service)
-			if diff := cmp.Diff(tc.want, got); diff != "" {
-				t.Fatal(diff)
+			if got := Clustername(tc.service); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
 			}
 		})
 	}
@@ -94,18 +56,23 @@ func TestHashname(t *testing.T) {
 	}{
 		{name: "empty s", l: 99, s: nil, want: ""},
 		{name: "single element", l: 99, s: []string{"alpha"}, want: "alpha"},
-		{name: "long single element, hashed", l: 12, s: []string{"gammagammagamma"}, want: "0d350ea5c204"},
-		{name: "single element, truncated", l: 4, s: []string{"alpha"}, want: "8ed3"},
-		{name: "two elements, truncated", l: 19, s: []string{"gammagamma", "betabeta"}, want: "ga-edf159/betabeta"},
+		{name: "long single element, hashed", l: 12, s: []string{"gammagammagamma"}, want: "07f44b81ba3d"},
+		{name: "single element, truncated", l: 4, s: []string{"alpha"}, want: "be76"},
+		{name: "fits exactly, untouched", l: 19, s: []string{"gammagamma", "betabeta"}, want: "gammagamma/betabeta"},
 		{name: "three elements", l: 99, s: []string{"alpha", "beta", "gamma"}, want: "alpha/beta/gamma"},
-		{name: "issue/25", l: 60, s: []string{"default", "my-service-name", "my-very-very-long-service-host-name.my.domainname"}, want: "default/my-service-name/my-very-very--c4d2d4"},
+		{
+			name: "long element hashed, short elements untouched",
+			l:    60,
+			s:    []string{"default", "my-service-name", "my-very-very-long-service-host-name.my.domainname"},
+			want: "default/my-service-name/753911f286ee486e9e6",
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			got := Hashname(tc.l, append([]string{}, tc.s...)...)
 			if got != tc.want {
-				t.Fatalf("hashname(%d, %q): got %q, want %q", tc.l, tc.s, got, tc.want)
+				t.Fatalf("Hashname(%d, %q): got %q, want %q", tc.l, tc.s, got, tc.want)
 			}
 		})
 	}
@@ -125,33 +92,16 @@ func TestTruncate(t *testing.T) {
 		{name: "truncate suffix", l: 4, s: "quijibo", suffix: "a8c5", want: "a8c5"},
 		{name: "truncate more", l: 3, s: "quijibo", suffix: "a8c5", want: "a8c"},
 		{name: "long single element, truncated", l: 9, s: "gammagamma", suffix: "0d350e", want: "ga-0d350e"},
-		{name: "long single element, truncated", l: 12, s: "gammagammagamma", suffix: "0d350e", want: "gamma-0d350e"},
-		{name: "issue/25", l: 60 / 3, s: "my-very-very-long-service-host-name.my.domainname", suffix: "a8c5e6", want: "my-very-very--a8c5e6"},
+		{name: "longer single element, truncated", l: 12, s: "gammagammagamma", suffix: "0d350e", want: "gamma-0d350e"},
+		{name: "issue/25", l: 20, s: "my-very-very-long-service-host-name.my.domainname", suffix: "a8c5e6", want: "my-very-very--a8c5e6"},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			got := truncate(tc.l, tc.s, tc.suffix)
 			if got != tc.want {
-				t.Fatalf("hashname(%d, %q, %q): got %q, want %q", tc.l, tc.s, tc.suffix, got, tc.want)
+				t.Fatalf("truncate(%d, %q, %q): got %q, want %q", tc.l, tc.s, tc.suffix, got, tc.want)
 			}
 		})
 	}
 }
-
-func service(ns, name string, ports ...v1.ServicePort) *v1.Service {
-	return serviceWithAnnotations(ns, name, nil, ports...)
-}
-
-func serviceWithAnnotations(ns, name string, annotations map[string]string, ports ...v1.ServicePort) *v1.Service {
-	return &v1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        name,
-			Namespace:   ns,
-			Annotations: annotations,
-		},
-		Spec: v1.ServiceSpec{
-			Ports: ports,
-		},
-	}
-}
\ No newline at end of file
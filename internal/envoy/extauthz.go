@@ -0,0 +1,101 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+// ExtAuthz describes an ExtensionService upstream that an
+// envoy.filters.http.ext_authz filter delegates authorization decisions to.
+// ClusterName names the cluster Contour synthesizes for the upstream (via
+// Clustername, so existing CDS caching is unaffected).
+type ExtAuthz struct {
+	ClusterName      string
+	GRPC             bool // gRPC authz service; HTTP (raw_http) otherwise
+	Timeout          string
+	FailureModeAllow bool
+	IncludedHeaders  []string // request headers forwarded to the authz service
+}
+
+// ExtAuthzFilter returns a new envoy.filters.http.ext_authz HTTP filter that
+// delegates authorization to authz. It is intended to be passed to
+// HTTPConnectionManager ahead of envoy.router, with per-route disablement
+// via typed_per_filter_config (see ExtAuthzDisabled); whether the filter is
+// present for a given vhost is up to the caller driving this builder.
+func ExtAuthzFilter(authz ExtAuthz) *types.Value {
+	config := map[string]*types.Value{
+		"failure_mode_allow": {Kind: &types.Value_BoolValue{BoolValue: authz.FailureModeAllow}},
+	}
+
+	if authz.GRPC {
+		config["grpc_service"] = st(map[string]*types.Value{
+			"envoy_grpc": st(map[string]*types.Value{
+				"cluster_name": sv(authz.ClusterName),
+			}),
+			"timeout": sv(authz.Timeout),
+		})
+	} else {
+		config["http_service"] = st(map[string]*types.Value{
+			"server_uri": st(map[string]*types.Value{
+				"cluster": sv(authz.ClusterName),
+				"timeout": sv(authz.Timeout),
+			}),
+			"authorization_request": st(map[string]*types.Value{
+				"allowed_headers": st(map[string]*types.Value{
+					"patterns": lv(headerPatterns(authz.IncludedHeaders)...),
+				}),
+			}),
+		})
+	}
+
+	return st(map[string]*types.Value{
+		"name":   sv("envoy.filters.http.ext_authz"),
+		"config": st(config),
+	})
+}
+
+// ExtAuthzDisabled returns the per-route filter config override that
+// disables the ext_authz filter for a single route.
+func ExtAuthzDisabled() (string, *types.Value) {
+	return "envoy.filters.http.ext_authz", st(map[string]*types.Value{
+		"disabled": {Kind: &types.Value_BoolValue{BoolValue: true}},
+	})
+}
+
+// ExtAuthzFilterForVirtualHost returns the envoy.filters.http.ext_authz
+// filter configured from vhost.AuthorizationService, or nil if vhost does
+// not delegate authorization to an external server.
+func ExtAuthzFilterForVirtualHost(vhost *dag.VirtualHost) *types.Value {
+	authz := vhost.AuthorizationService
+	if authz == nil {
+		return nil
+	}
+	return ExtAuthzFilter(ExtAuthz{
+		ClusterName:      Clustername(authz.Upstream),
+		GRPC:             authz.GRPC,
+		Timeout:          authz.Timeout,
+		FailureModeAllow: authz.FailureModeAllow,
+		IncludedHeaders:  authz.IncludedHeaders,
+	})
+}
+
+func headerPatterns(headers []string) []*types.Value {
+	values := make([]*types.Value, len(headers))
+	for i, h := range headers {
+		values[i] = st(map[string]*types.Value{"exact": sv(h)})
+	}
+	return values
+}
@@ -0,0 +1,145 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+func TestExtAuthzFilter(t *testing.T) {
+	tests := map[string]struct {
+		authz ExtAuthz
+		want  *types.Value
+	}{
+		"grpc authz service": {
+			authz: ExtAuthz{
+				ClusterName:      "opa",
+				GRPC:             true,
+				Timeout:          "2s",
+				FailureModeAllow: false,
+			},
+			want: st(map[string]*types.Value{
+				"name": sv("envoy.filters.http.ext_authz"),
+				"config": st(map[string]*types.Value{
+					"failure_mode_allow": {Kind: &types.Value_BoolValue{BoolValue: false}},
+					"grpc_service": st(map[string]*types.Value{
+						"envoy_grpc": st(map[string]*types.Value{
+							"cluster_name": sv("opa"),
+						}),
+						"timeout": sv("2s"),
+					}),
+				}),
+			}),
+		},
+		"http authz service": {
+			authz: ExtAuthz{
+				ClusterName:     "oidc-sidecar",
+				Timeout:         "1s",
+				IncludedHeaders: []string{"authorization"},
+			},
+			want: st(map[string]*types.Value{
+				"name": sv("envoy.filters.http.ext_authz"),
+				"config": st(map[string]*types.Value{
+					"failure_mode_allow": {Kind: &types.Value_BoolValue{BoolValue: false}},
+					"http_service": st(map[string]*types.Value{
+						"server_uri": st(map[string]*types.Value{
+							"cluster": sv("oidc-sidecar"),
+							"timeout": sv("1s"),
+						}),
+						"authorization_request": st(map[string]*types.Value{
+							"allowed_headers": st(map[string]*types.Value{
+								"patterns": lv(st(map[string]*types.Value{"exact": sv("authorization")})),
+							}),
+						}),
+					}),
+				}),
+			}),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := ExtAuthzFilter(tc.authz)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestExtAuthzFilterOrder(t *testing.T) {
+	filter := ExtAuthzFilter(ExtAuthz{ClusterName: "opa", GRPC: true, Timeout: "2s"})
+
+	hcm := HTTPConnectionManager("default/echo", FileAccessLog("/dev/stdout", ""), filter)
+
+	filters := hcm.Config.Fields["http_filters"].GetListValue().Values
+	var got []string
+	for _, f := range filters {
+		got = append(got, f.GetStructValue().Fields["name"].GetStringValue())
+	}
+
+	want := []string{
+		"envoy.gzip",
+		"envoy.grpc_web",
+		"envoy.filters.http.ext_authz",
+		"envoy.router",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestExtAuthzFilterForVirtualHost(t *testing.T) {
+	vhost := &dag.VirtualHost{
+		AuthorizationService: &dag.AuthorizationService{
+			Upstream:         &dag.Service{Namespace: "default", Name: "opa", Port: 9191},
+			GRPC:             true,
+			Timeout:          "2s",
+			FailureModeAllow: true,
+		},
+	}
+
+	got := ExtAuthzFilterForVirtualHost(vhost)
+	want := ExtAuthzFilter(ExtAuthz{
+		ClusterName:      "default/opa/9191",
+		GRPC:             true,
+		Timeout:          "2s",
+		FailureModeAllow: true,
+	})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestExtAuthzFilterForVirtualHostNoService(t *testing.T) {
+	if got := ExtAuthzFilterForVirtualHost(&dag.VirtualHost{}); got != nil {
+		t.Fatalf("got %v, want nil", got)
+	}
+}
+
+func TestExtAuthzDisabled(t *testing.T) {
+	name, override := ExtAuthzDisabled()
+
+	if name != "envoy.filters.http.ext_authz" {
+		t.Fatalf("got filter name %q, want envoy.filters.http.ext_authz", name)
+	}
+	if disabled := override.GetStructValue().Fields["disabled"].GetBoolValue(); !disabled {
+		t.Fatal("expected disabled override to be true")
+	}
+}
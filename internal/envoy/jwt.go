@@ -0,0 +1,207 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"strconv"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+// JWTProvider describes a single JWT issuer that an envoy.filters.http.jwt_authn
+// filter will accept tokens from. JWKSCluster is the name of the Envoy
+// cluster Contour synthesizes to fetch the provider's JWKS over HTTP; it is
+// empty when Keys is supplied instead.
+type JWTProvider struct {
+	Name           string
+	Issuer         string
+	Audiences      []string
+	JWKSCluster    string
+	JWKSURI        string
+	Keys           string // inline JWKS, used instead of JWKSCluster/JWKSURI
+	ForwardJWT     bool
+	ClaimToHeaders map[string]string // claim name -> header name
+}
+
+// Requirement describes which of a route's JWTProviders must be satisfied.
+// Exactly one of Any or All should be set; an empty Requirement permits
+// unauthenticated requests to pass through the filter.
+type Requirement struct {
+	Any []string
+	All []string
+}
+
+// Rule pairs a route's path MatchCondition (as compiled by the DAG from
+// IngressRoute or HTTPRoute) with the Requirement its matching requests
+// must satisfy.
+type Rule struct {
+	Match       dag.MatchCondition
+	Requirement Requirement
+}
+
+// JWTAuthentication returns a new envoy.filters.http.jwt_authn HTTP filter
+// configured with providers and, for each Rule, the providers that must
+// accept the bearer token of a request matching Rule.Match. It is intended
+// to be passed to HTTPConnectionManager ahead of RBACFilter so that RBAC
+// principals can key off claims the filter verifies and forwards as dynamic
+// metadata.
+func JWTAuthentication(providers []JWTProvider, rules []Rule) *types.Value {
+	providerFields := make(map[string]*types.Value, len(providers))
+	for _, p := range providers {
+		providerFields[p.Name] = jwtProvider(p)
+	}
+
+	ruleFields := make([]*types.Value, 0, len(rules))
+	for _, r := range rules {
+		ruleFields = append(ruleFields, st(map[string]*types.Value{
+			"match":    routeMatch(r.Match),
+			"requires": requirement(r.Requirement),
+		}))
+	}
+
+	return st(map[string]*types.Value{
+		"name": sv("envoy.filters.http.jwt_authn"),
+		"config": st(map[string]*types.Value{
+			"providers": st(providerFields),
+			"rules":     lv(ruleFields...),
+		}),
+	})
+}
+
+// JWTAuthenticationForVirtualHost builds the envoy.filters.http.jwt_authn
+// filter for vhost from its JWTProviders and the JWTRequirement of each of
+// its Routes, or returns nil if vhost has no JWTProviders. JWKS clusters
+// Contour must synthesize for remote providers are named via Hashname,
+// keyed off JWTProvider.JWKSHost/JWKSPort.
+func JWTAuthenticationForVirtualHost(vhost *dag.VirtualHost) *types.Value {
+	if len(vhost.JWTProviders) == 0 {
+		return nil
+	}
+
+	providers := make([]JWTProvider, 0, len(vhost.JWTProviders))
+	for _, p := range vhost.JWTProviders {
+		providers = append(providers, jwtProviderFromDAG(p))
+	}
+
+	var rules []Rule
+	for _, route := range vhost.Routes {
+		if route.JWTRequirement == nil {
+			continue
+		}
+		req := Requirement{}
+		if route.JWTRequirement.RequireAll {
+			req.All = route.JWTRequirement.ProviderNames
+		} else {
+			req.Any = route.JWTRequirement.ProviderNames
+		}
+		rules = append(rules, Rule{Match: route.PathMatchCondition, Requirement: req})
+	}
+
+	return JWTAuthentication(providers, rules)
+}
+
+func jwtProviderFromDAG(p dag.JWTProvider) JWTProvider {
+	provider := JWTProvider{
+		Name:           p.Name,
+		Issuer:         p.Issuer,
+		Audiences:      p.Audiences,
+		JWKSURI:        p.JWKSURI,
+		Keys:           p.Keys,
+		ForwardJWT:     p.ForwardJWT,
+		ClaimToHeaders: p.ClaimToHeaders,
+	}
+	if p.JWKSHost != "" {
+		provider.JWKSCluster = Hashname(60, p.JWKSHost, strconv.Itoa(int(p.JWKSPort)))
+	}
+	return provider
+}
+
+// routeMatch translates a DAG MatchCondition into the jwt_authn filter's
+// RouteMatch, so a Rule's path type (prefix vs exact) is the route's own,
+// rather than an opaque route identifier reinterpreted as a path.
+func routeMatch(m dag.MatchCondition) *types.Value {
+	switch c := m.(type) {
+	case dag.ExactMatchCondition:
+		return st(map[string]*types.Value{"path": sv(c.Path)})
+	case dag.PrefixMatchCondition:
+		return st(map[string]*types.Value{"prefix": sv(c.Prefix)})
+	default:
+		return st(map[string]*types.Value{"prefix": sv("/")})
+	}
+}
+
+func jwtProvider(p JWTProvider) *types.Value {
+	fields := map[string]*types.Value{
+		"issuer":  sv(p.Issuer),
+		"forward": {Kind: &types.Value_BoolValue{BoolValue: p.ForwardJWT}},
+		// payload_in_metadata names the dynamic metadata namespace this
+		// provider's verified claims are published under, keyed by provider
+		// name so RBACFilter's principals() can address them unambiguously
+		// when more than one JWTProvider is configured.
+		"payload_in_metadata": sv(p.Name),
+	}
+	if len(p.Audiences) > 0 {
+		values := make([]*types.Value, len(p.Audiences))
+		for i, a := range p.Audiences {
+			values[i] = sv(a)
+		}
+		fields["audiences"] = lv(values...)
+	}
+	switch {
+	case p.Keys != "":
+		fields["local_jwks"] = st(map[string]*types.Value{
+			"inline_string": sv(p.Keys),
+		})
+	default:
+		fields["remote_jwks"] = st(map[string]*types.Value{
+			"http_uri": st(map[string]*types.Value{
+				"uri":     sv(p.JWKSURI),
+				"cluster": sv(p.JWKSCluster),
+				"timeout": sv("5s"),
+			}),
+			"cache_duration": sv("300s"),
+		})
+	}
+	if len(p.ClaimToHeaders) > 0 {
+		mappings := make([]*types.Value, 0, len(p.ClaimToHeaders))
+		for claim, header := range p.ClaimToHeaders {
+			mappings = append(mappings, st(map[string]*types.Value{
+				"header_name": sv(header),
+				"claim_name":  sv(claim),
+			}))
+		}
+		fields["claim_to_headers"] = lv(mappings...)
+	}
+	return st(fields)
+}
+
+func requirement(r Requirement) *types.Value {
+	switch {
+	case len(r.Any) > 0:
+		return st(map[string]*types.Value{"requires_any": st(map[string]*types.Value{"requirements": lv(providerNames(r.Any)...)})})
+	case len(r.All) > 0:
+		return st(map[string]*types.Value{"requires_all": st(map[string]*types.Value{"requirements": lv(providerNames(r.All)...)})})
+	default:
+		return st(map[string]*types.Value{"allow_missing_or_failed": {Kind: &types.Value_BoolValue{BoolValue: true}}})
+	}
+}
+
+func providerNames(names []string) []*types.Value {
+	values := make([]*types.Value, len(names))
+	for i, n := range names {
+		values[i] = st(map[string]*types.Value{"provider_name": sv(n)})
+	}
+	return values
+}
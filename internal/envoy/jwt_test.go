@@ -0,0 +1,131 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/heptio/contour/internal/dag"
+)
+
+func TestJWTAuthentication(t *testing.T) {
+	got := JWTAuthentication(
+		[]JWTProvider{{
+			Name:        "auth0",
+			Issuer:      "https://contour.example.com/",
+			Audiences:   []string{"contour"},
+			JWKSCluster: "auth0-jwks",
+			JWKSURI:     "https://auth0.example.com/.well-known/jwks.json",
+		}},
+		[]Rule{{
+			Match:       dag.PrefixMatchCondition{Prefix: "/"},
+			Requirement: Requirement{Any: []string{"auth0"}},
+		}},
+	)
+
+	name := got.GetStructValue().Fields["name"].GetStringValue()
+	if name != "envoy.filters.http.jwt_authn" {
+		t.Fatalf("got filter name %q, want envoy.filters.http.jwt_authn", name)
+	}
+
+	providers := got.GetStructValue().Fields["config"].GetStructValue().Fields["providers"].GetStructValue().Fields
+	if _, ok := providers["auth0"]; !ok {
+		t.Fatal("expected provider \"auth0\" to be configured")
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	tests := map[string]struct {
+		match dag.MatchCondition
+		key   string
+		want  string
+	}{
+		"prefix match":  {match: dag.PrefixMatchCondition{Prefix: "/api"}, key: "prefix", want: "/api"},
+		"exact match":   {match: dag.ExactMatchCondition{Path: "/healthz"}, key: "path", want: "/healthz"},
+		"unknown match": {match: nil, key: "prefix", want: "/"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := routeMatch(tc.match).GetStructValue().Fields[tc.key].GetStringValue()
+			if got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticationForVirtualHost(t *testing.T) {
+	vhost := &dag.VirtualHost{
+		JWTProviders: []dag.JWTProvider{{
+			Name:     "auth0",
+			Issuer:   "https://contour.example.com/",
+			JWKSURI:  "https://auth0.example.com/.well-known/jwks.json",
+			JWKSHost: "auth0.example.com",
+			JWKSPort: 443,
+		}},
+		Routes: []*dag.Route{{
+			PathMatchCondition: dag.PrefixMatchCondition{Prefix: "/"},
+			JWTRequirement:     &dag.JWTRequirement{ProviderNames: []string{"auth0"}},
+		}},
+	}
+
+	got := JWTAuthenticationForVirtualHost(vhost)
+
+	providerFields := got.GetStructValue().Fields["config"].GetStructValue().Fields["providers"].GetStructValue().Fields["auth0"].GetStructValue().Fields
+	cluster := providerFields["remote_jwks"].GetStructValue().Fields["http_uri"].GetStructValue().Fields["cluster"].GetStringValue()
+	if cluster != "auth0.example.com/443" {
+		t.Fatalf("got JWKS cluster %q, want %q", cluster, "auth0.example.com/443")
+	}
+
+	if diff := cmp.Diff(1, len(got.GetStructValue().Fields["config"].GetStructValue().Fields["rules"].GetListValue().Values)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestJWTAuthenticationForVirtualHostNoProviders(t *testing.T) {
+	if got := JWTAuthenticationForVirtualHost(&dag.VirtualHost{}); got != nil {
+		t.Fatalf("got %v, want nil for a virtual host with no JWTProviders", got)
+	}
+}
+
+// TestHTTPConnectionManagerFilterOrder asserts that filters passed to
+// HTTPConnectionManager are emitted in the caller-supplied order, between
+// envoy.grpc_web and envoy.router, so that JWT validation runs ahead of RBAC
+// enforcement.
+func TestHTTPConnectionManagerFilterOrder(t *testing.T) {
+	jwt := JWTAuthentication(nil, nil)
+	rbac := RBACFilter(RBACAllow, nil)
+
+	hcm := HTTPConnectionManager("default/echo", FileAccessLog("/dev/stdout", ""), jwt, rbac)
+
+	filters := hcm.Config.Fields["http_filters"].GetListValue().Values
+	var got []string
+	for _, f := range filters {
+		got = append(got, f.GetStructValue().Fields["name"].GetStringValue())
+	}
+
+	want := []string{
+		"envoy.gzip",
+		"envoy.grpc_web",
+		"envoy.filters.http.jwt_authn",
+		"envoy.filters.http.rbac",
+		"envoy.router",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
@@ -26,9 +26,26 @@ func TLSInspector() listener.ListenerFilter {
 	}
 }
 
-// HTTPConnectionManager creates a new HTTP Connection Manager filter
-// for the supplied route and access log.
-func HTTPConnectionManager(routename, accessLogPath string) listener.Filter {
+// HTTPConnectionManager creates a new HTTP Connection Manager filter for the
+// supplied route, emitting accessLog entries (built by FileAccessLog,
+// JSONAccessLog or one of the gRPC ALS builders). filters is an ordered list
+// of additional HTTP filters (as returned by builders such as RBACFilter)
+// inserted between envoy.grpc_web and envoy.router; callers are
+// responsible for passing them in the order they should execute.
+func HTTPConnectionManager(routename string, accessLog *types.Value, filters ...*types.Value) listener.Filter {
+	httpFilters := []*types.Value{
+		st(map[string]*types.Value{
+			"name": sv("envoy.gzip"),
+		}),
+		st(map[string]*types.Value{
+			"name": sv("envoy.grpc_web"),
+		}),
+	}
+	httpFilters = append(httpFilters, filters...)
+	httpFilters = append(httpFilters, st(map[string]*types.Value{
+		"name": sv("envoy.router"),
+	}))
+
 	return listener.Filter{
 		Name: "envoy.http_connection_manager",
 		Config: &types.Struct{
@@ -49,35 +66,14 @@ func HTTPConnectionManager(routename, accessLogPath string) listener.Filter {
 						}),
 					}),
 				}),
-				"http_filters": lv(
-					st(map[string]*types.Value{
-						"name": sv("envoy.gzip"),
-					}),
-					st(map[string]*types.Value{
-						"name": sv("envoy.grpc_web"),
-					}),
-					st(map[string]*types.Value{
-						"name": sv("envoy.router"),
-					}),
-				),
+				"http_filters":       lv(httpFilters...),
 				"use_remote_address": {Kind: &types.Value_BoolValue{BoolValue: true}}, // TODO(jbeda) should this ever be false?
-				"access_log":         accesslog(accessLogPath),
+				"access_log":         lv(accessLog),
 			},
 		},
 	}
 }
 
-func accesslog(path string) *types.Value {
-	return lv(
-		st(map[string]*types.Value{
-			"name": sv("envoy.file_access_log"),
-			"config": st(map[string]*types.Value{
-				"path": sv(path),
-			}),
-		}),
-	)
-}
-
 func sv(s string) *types.Value {
 	return &types.Value{Kind: &types.Value_StringValue{StringValue: s}}
 }
@@ -0,0 +1,241 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+// RBACAction is the action Envoy takes when a request does not match any
+// policy in an RBACFilter.
+type RBACAction string
+
+const (
+	// RBACAllow permits requests that do not match any policy.
+	RBACAllow RBACAction = "ALLOW"
+	// RBACDeny rejects requests that do not match any policy.
+	RBACDeny RBACAction = "DENY"
+)
+
+// Principal identifies a downstream peer that a Policy applies to. Namespace
+// and ServiceAccount match the SPIFFE SAN Envoy observes on the peer's mTLS
+// certificate (spiffe://<trust-domain>/ns/<Namespace>/sa/<ServiceAccount>);
+// ServiceAccount may be empty to match any service account in Namespace.
+// JWTProvider, JWTClaim and JWTClaimValue, if set, require the named
+// JWTProvider (see JWTAuthentication) to have verified a claim called
+// JWTClaim equal to JWTClaimValue; JWTProvider must match a JWTProvider.Name
+// passed to the same route's JWTAuthentication filter, since that is the
+// dynamic metadata namespace the claim is published under.
+type Principal struct {
+	Namespace      string
+	ServiceAccount string
+	JWTProvider    string
+	JWTClaim       string
+	JWTClaimValue  string
+}
+
+// Permission describes the HTTP attributes of a request a Policy applies to.
+// A zero value Permission matches any request.
+type Permission struct {
+	Methods []string
+	Paths   []string
+}
+
+// Policy pairs a set of Principals with the Permissions they are allowed (or
+// denied, depending on the enclosing RBACFilter's action) to exercise.
+type Policy struct {
+	Principals  []Principal
+	Permissions []Permission
+}
+
+// RBACFilter returns a new envoy.filters.http.rbac HTTP filter that enforces
+// policies, falling back to action for any request that matches none of
+// them. It is intended to be passed to HTTPConnectionManager ahead of the
+// router filter.
+func RBACFilter(action RBACAction, policies map[string]Policy) *types.Value {
+	fields := make(map[string]*types.Value, len(policies))
+	for name, policy := range policies {
+		fields[name] = st(map[string]*types.Value{
+			"permissions": lv(permissions(policy.Permissions)...),
+			"principals":  lv(principals(policy.Principals)...),
+		})
+	}
+	return st(map[string]*types.Value{
+		"name": sv("envoy.filters.http.rbac"),
+		"config": st(map[string]*types.Value{
+			"rules": st(map[string]*types.Value{
+				"action":   sv(string(action)),
+				"policies": st(fields),
+			}),
+		}),
+	})
+}
+
+func permissions(pp []Permission) []*types.Value {
+	if len(pp) == 0 {
+		return []*types.Value{st(map[string]*types.Value{"any": {Kind: &types.Value_BoolValue{BoolValue: true}}})}
+	}
+	var values []*types.Value
+	for _, p := range pp {
+		var rules []*types.Value
+		for _, m := range p.Methods {
+			rules = append(rules, st(map[string]*types.Value{
+				"header": st(map[string]*types.Value{
+					"name":        sv(":method"),
+					"exact_match": sv(m),
+				}),
+			}))
+		}
+		for _, path := range p.Paths {
+			rules = append(rules, st(map[string]*types.Value{
+				"url_path": st(map[string]*types.Value{
+					"path": st(map[string]*types.Value{
+						"exact": sv(path),
+					}),
+				}),
+			}))
+		}
+		if len(rules) == 0 {
+			values = append(values, st(map[string]*types.Value{"any": {Kind: &types.Value_BoolValue{BoolValue: true}}}))
+			continue
+		}
+		if len(rules) == 1 {
+			values = append(values, rules[0])
+			continue
+		}
+		values = append(values, st(map[string]*types.Value{"and_rules": st(map[string]*types.Value{"rules": lv(rules...)})}))
+	}
+	return values
+}
+
+func principals(pp []Principal) []*types.Value {
+	if len(pp) == 0 {
+		return []*types.Value{st(map[string]*types.Value{"any": {Kind: &types.Value_BoolValue{BoolValue: true}}})}
+	}
+	var values []*types.Value
+	for _, p := range pp {
+		switch {
+		case p.JWTClaim != "":
+			values = append(values, st(map[string]*types.Value{
+				"metadata": st(map[string]*types.Value{
+					"filter": sv("envoy.filters.http.jwt_authn"),
+					// jwt_authn nests each provider's verified payload under
+					// its own payload_in_metadata namespace, so reaching a
+					// claim takes two path segments: the provider name, then
+					// the claim.
+					"path": lv(
+						st(map[string]*types.Value{"key": sv(p.JWTProvider)}),
+						st(map[string]*types.Value{"key": sv(p.JWTClaim)}),
+					),
+					"value": st(map[string]*types.Value{
+						"string_match": st(map[string]*types.Value{
+							"exact": sv(p.JWTClaimValue),
+						}),
+					}),
+				}),
+			}))
+		case p.ServiceAccount == "":
+			values = append(values, st(map[string]*types.Value{
+				"authenticated": st(map[string]*types.Value{
+					"principal_name": st(map[string]*types.Value{
+						"prefix": sv(spiffeIDPrefix(p.Namespace)),
+					}),
+				}),
+			}))
+		default:
+			values = append(values, st(map[string]*types.Value{
+				"authenticated": st(map[string]*types.Value{
+					"principal_name": st(map[string]*types.Value{
+						"exact": sv(spiffeID(p.Namespace, p.ServiceAccount)),
+					}),
+				}),
+			}))
+		}
+	}
+	return values
+}
+
+// spiffeID constructs the SPIFFE URI SAN Contour expects on a peer's mTLS
+// certificate for a given namespace and service account.
+func spiffeID(namespace, serviceAccount string) string {
+	return "spiffe://cluster.local/ns/" + namespace + "/sa/" + serviceAccount
+}
+
+// spiffeIDPrefix constructs the prefix of a SPIFFE URI SAN common to every
+// service account in namespace, for principal_name.prefix matching when a
+// Principal leaves ServiceAccount empty to mean "any service account in
+// namespace". Envoy's StringMatcher.exact never treats "*" as a wildcard, so
+// this must be matched with a prefix, not an exact string containing "*".
+func spiffeIDPrefix(namespace string) string {
+	return "spiffe://cluster.local/ns/" + namespace + "/sa/"
+}
+
+// RBACFilterForVirtualHost builds the envoy.filters.http.rbac HTTP filter
+// for vhost from its AuthorizationPolicy and each Route's override of it,
+// or returns nil if neither is set (or every applicable policy is
+// Disabled), so the caller building the HTTP filter chain can omit the
+// filter entirely rather than emitting a no-op one. Each AuthorizationRule
+// becomes its own keyed Policy, so a Route whose AuthorizationPolicy
+// changes only updates the policies keyed to it when the DAG is rebuilt and
+// pushed over RDS/LDS, with no Envoy listener restart required.
+func RBACFilterForVirtualHost(vhost *dag.VirtualHost) *types.Value {
+	action := RBACAllow
+	if vhost.AuthorizationPolicy != nil && vhost.AuthorizationPolicy.DefaultAction == "DENY" {
+		action = RBACDeny
+	}
+
+	policies := make(map[string]Policy)
+	for i, route := range vhost.Routes {
+		policy := route.AuthorizationPolicy
+		if policy == nil {
+			policy = vhost.AuthorizationPolicy
+		}
+		if policy == nil || policy.Disabled {
+			continue
+		}
+		for j, rule := range policy.Rules {
+			principals := principalsFromDAG(rule.Principals)
+			for k := range principals {
+				if principals[k].JWTClaim != "" && principals[k].JWTProvider == "" && len(vhost.JWTProviders) > 0 {
+					principals[k].JWTProvider = vhost.JWTProviders[0].Name
+				}
+			}
+			policies[fmt.Sprintf("route-%d-rule-%d", i, j)] = Policy{
+				Principals:  principals,
+				Permissions: []Permission{{Methods: rule.Methods, Paths: rule.Paths}},
+			}
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	return RBACFilter(action, policies)
+}
+
+func principalsFromDAG(pp []dag.AuthorizationPrincipal) []Principal {
+	principals := make([]Principal, 0, len(pp))
+	for _, p := range pp {
+		principals = append(principals, Principal{
+			Namespace:      p.Namespace,
+			ServiceAccount: p.ServiceAccount,
+			JWTProvider:    p.JWTProvider,
+			JWTClaim:       p.JWTClaim,
+			JWTClaimValue:  p.JWTClaimValue,
+		})
+	}
+	return principals
+}
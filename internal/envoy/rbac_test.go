@@ -0,0 +1,195 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+func TestSpiffeID(t *testing.T) {
+	tests := map[string]struct {
+		namespace      string
+		serviceAccount string
+		want           string
+	}{
+		"namespace and service account": {
+			namespace:      "prod",
+			serviceAccount: "api",
+			want:           "spiffe://cluster.local/ns/prod/sa/api",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := spiffeID(tc.namespace, tc.serviceAccount)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestSpiffeIDPrefix(t *testing.T) {
+	got := spiffeIDPrefix("prod")
+	want := "spiffe://cluster.local/ns/prod/sa/"
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+// TestPrincipalsJWTClaimMetadataPath guards the integration between
+// RBACFilter and JWTAuthentication: the metadata path must descend through
+// the provider's payload_in_metadata namespace before the claim, or the
+// principal can never match a claim jwt_authn actually publishes.
+func TestPrincipalsJWTClaimMetadataPath(t *testing.T) {
+	jwt := JWTAuthentication([]JWTProvider{{Name: "auth0", Issuer: "https://contour.example.com/"}}, nil)
+	payloadNamespace := jwt.GetStructValue().Fields["config"].GetStructValue().
+		Fields["providers"].GetStructValue().Fields["auth0"].GetStructValue().
+		Fields["payload_in_metadata"].GetStringValue()
+
+	got := principals([]Principal{{JWTProvider: "auth0", JWTClaim: "sub", JWTClaimValue: "alice"}})
+
+	path := got[0].GetStructValue().Fields["metadata"].GetStructValue().Fields["path"].GetListValue().Values
+	if len(path) != 2 {
+		t.Fatalf("got %d path segments, want 2", len(path))
+	}
+	if got := path[0].GetStructValue().Fields["key"].GetStringValue(); got != payloadNamespace {
+		t.Fatalf("first path segment %q does not match provider's payload_in_metadata %q", got, payloadNamespace)
+	}
+	if got := path[1].GetStructValue().Fields["key"].GetStringValue(); got != "sub" {
+		t.Fatalf("got second path segment %q, want \"sub\"", got)
+	}
+}
+
+// TestPrincipalsAnyServiceAccountUsesPrefixMatch guards against regressing
+// to an exact match on a literal "*", which Envoy's StringMatcher.exact does
+// not treat as a wildcard — every real certificate would fail to match.
+func TestPrincipalsAnyServiceAccountUsesPrefixMatch(t *testing.T) {
+	got := principals([]Principal{{Namespace: "prod"}})
+
+	want := []*types.Value{st(map[string]*types.Value{
+		"authenticated": st(map[string]*types.Value{
+			"principal_name": st(map[string]*types.Value{
+				"prefix": sv("spiffe://cluster.local/ns/prod/sa/"),
+			}),
+		}),
+	})}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestRBACFilter(t *testing.T) {
+	got := RBACFilter(RBACDeny, map[string]Policy{
+		"allow-checkout": {
+			Principals: []Principal{{
+				Namespace:      "prod",
+				ServiceAccount: "frontend",
+			}},
+			Permissions: []Permission{{
+				Methods: []string{"GET"},
+				Paths:   []string{"/checkout"},
+			}},
+		},
+	})
+
+	want := st(map[string]*types.Value{
+		"name": sv("envoy.filters.http.rbac"),
+		"config": st(map[string]*types.Value{
+			"rules": st(map[string]*types.Value{
+				"action": sv("DENY"),
+				"policies": st(map[string]*types.Value{
+					"allow-checkout": st(map[string]*types.Value{
+						"permissions": lv(st(map[string]*types.Value{
+							"and_rules": st(map[string]*types.Value{
+								"rules": lv(
+									st(map[string]*types.Value{
+										"header": st(map[string]*types.Value{
+											"name":        sv(":method"),
+											"exact_match": sv("GET"),
+										}),
+									}),
+									st(map[string]*types.Value{
+										"url_path": st(map[string]*types.Value{
+											"path": st(map[string]*types.Value{
+												"exact": sv("/checkout"),
+											}),
+										}),
+									}),
+								),
+							}),
+						})),
+						"principals": lv(st(map[string]*types.Value{
+							"authenticated": st(map[string]*types.Value{
+								"principal_name": st(map[string]*types.Value{
+									"exact": sv("spiffe://cluster.local/ns/prod/sa/frontend"),
+								}),
+							}),
+						})),
+					}),
+				}),
+			}),
+		}),
+	})
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestRBACFilterForVirtualHost(t *testing.T) {
+	vhost := &dag.VirtualHost{
+		AuthorizationPolicy: &dag.AuthorizationPolicy{
+			DefaultAction: "DENY",
+			Rules: []dag.AuthorizationRule{{
+				Principals: []dag.AuthorizationPrincipal{{Namespace: "prod", ServiceAccount: "frontend"}},
+				Methods:    []string{"GET"},
+				Paths:      []string{"/checkout"},
+			}},
+		},
+		Routes: []*dag.Route{
+			{PathMatchCondition: dag.PrefixMatchCondition{Prefix: "/"}},
+			{
+				PathMatchCondition:  dag.PrefixMatchCondition{Prefix: "/admin"},
+				AuthorizationPolicy: &dag.AuthorizationPolicy{Disabled: true},
+			},
+		},
+	}
+
+	got := RBACFilterForVirtualHost(vhost)
+
+	action := got.GetStructValue().Fields["config"].GetStructValue().Fields["rules"].GetStructValue().Fields["action"].GetStringValue()
+	if action != "DENY" {
+		t.Fatalf("got action %q, want DENY", action)
+	}
+
+	policies := got.GetStructValue().Fields["config"].GetStructValue().Fields["rules"].GetStructValue().Fields["policies"].GetStructValue().Fields
+	if _, ok := policies["route-0-rule-0"]; !ok {
+		t.Fatal("expected a policy for route 0's inherited AuthorizationPolicy")
+	}
+	if _, ok := policies["route-1-rule-0"]; ok {
+		t.Fatal("route 1 disables RBAC and should contribute no policy")
+	}
+}
+
+func TestRBACFilterForVirtualHostNoPolicy(t *testing.T) {
+	if got := RBACFilterForVirtualHost(&dag.VirtualHost{}); got != nil {
+		t.Fatalf("got %v, want nil for a virtual host with no AuthorizationPolicy", got)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/dag"
+)
+
+// WasmRuntime selects the VM Envoy uses to execute a Wasm module.
+type WasmRuntime string
+
+const (
+	WasmRuntimeV8   WasmRuntime = "envoy.wasm.runtime.v8"
+	WasmRuntimeWAVM WasmRuntime = "envoy.wasm.runtime.wavm"
+)
+
+// WasmSource describes where a Wasm module's bytes come from. Exactly one of
+// HTTPURI, Inline should be set; SHA256 is required whenever HTTPURI is set
+// so Envoy can validate the fetched module before loading it.
+type WasmSource struct {
+	HTTPURI string
+	Cluster string // Envoy cluster Contour synthesizes to fetch HTTPURI
+	Inline  []byte
+	SHA256  string
+}
+
+// WasmFilter returns a new envoy.filters.http.wasm HTTP filter that loads
+// name's module into runtime using source, with config as the opaque
+// per-instance JSON configuration passed to the module's root context. It is
+// intended to be passed to HTTPConnectionManager ahead of envoy.router.
+func WasmFilter(name string, runtime WasmRuntime, source WasmSource, config string) *types.Value {
+	vmConfig := map[string]*types.Value{
+		"runtime": sv(string(runtime)),
+		"code":    wasmCode(source),
+	}
+
+	return st(map[string]*types.Value{
+		"name": sv("envoy.filters.http.wasm"),
+		"config": st(map[string]*types.Value{
+			"config": st(map[string]*types.Value{
+				"name":          sv(name),
+				"configuration": sv(config),
+				"vm_config":     st(vmConfig),
+			}),
+		}),
+	})
+}
+
+func wasmCode(source WasmSource) *types.Value {
+	sha256 := source.SHA256
+	if source.Inline != nil && sha256 == "" {
+		sha256 = sha256sum(source.Inline)
+	}
+
+	remote := map[string]*types.Value{
+		"sha256": sv(sha256),
+	}
+	if source.HTTPURI != "" {
+		remote["http_uri"] = st(map[string]*types.Value{
+			"uri":     sv(source.HTTPURI),
+			"cluster": sv(source.Cluster),
+			"timeout": sv("10s"),
+		})
+		return st(map[string]*types.Value{"remote": st(remote)})
+	}
+
+	return st(map[string]*types.Value{
+		"local": st(map[string]*types.Value{
+			// inline_bytes is a protobuf bytes field; through the Struct/JSON
+			// encoding Envoy consumes it here it must be base64, not the raw
+			// module bytes reinterpreted as a string.
+			"inline_bytes": sv(base64.StdEncoding.EncodeToString(source.Inline)),
+			"sha256":       sv(sha256),
+		}),
+	})
+}
+
+func sha256sum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// WasmFilterDisabled returns the per-route filter config override that
+// disables the named Wasm filter for a single route, via the
+// typed_per_filter_config mechanism shared by most Envoy HTTP filters.
+func WasmFilterDisabled(filterName string) (string, *types.Value) {
+	return filterName, st(map[string]*types.Value{
+		"disabled": {Kind: &types.Value_BoolValue{BoolValue: true}},
+	})
+}
+
+// WasmFiltersForVirtualHost builds the envoy.filters.http.wasm HTTP filters
+// for vhost's WasmFilters, in the order declared, for the caller to pass to
+// HTTPConnectionManager ahead of envoy.router alongside the RBAC and JWT
+// filters. A remote module's fetch Cluster is named the same way
+// Clustername would name it, keyed off WasmFilter.Upstream, so the xDS
+// visitor can synthesize the CDS cluster without consulting this package
+// again.
+func WasmFiltersForVirtualHost(vhost *dag.VirtualHost) []*types.Value {
+	filters := make([]*types.Value, 0, len(vhost.WasmFilters))
+	for _, f := range vhost.WasmFilters {
+		source := WasmSource{
+			Inline: f.Inline,
+			SHA256: f.SHA256,
+		}
+		if f.Upstream != nil {
+			source.HTTPURI = f.HTTPPath
+			source.Cluster = Clustername(f.Upstream)
+		}
+		filters = append(filters, WasmFilter(f.Name, wasmRuntimeFromDAG(f.Runtime), source, ""))
+	}
+	return filters
+}
+
+// WasmDisabledOverridesForRoute returns the typed_per_filter_config
+// overrides disabling each of route's WasmDisabled filters, keyed by
+// filter name, for the RDS route this route compiles to.
+func WasmDisabledOverridesForRoute(route *dag.Route) map[string]*types.Value {
+	if len(route.WasmDisabled) == 0 {
+		return nil
+	}
+	overrides := make(map[string]*types.Value, len(route.WasmDisabled))
+	for _, name := range route.WasmDisabled {
+		k, v := WasmFilterDisabled(name)
+		overrides[k] = v
+	}
+	return overrides
+}
+
+func wasmRuntimeFromDAG(runtime string) WasmRuntime {
+	if runtime == "wavm" {
+		return WasmRuntimeWAVM
+	}
+	return WasmRuntimeV8
+}
@@ -0,0 +1,144 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/heptio/contour/internal/dag"
+)
+
+func TestWasmFilterModuleHashing(t *testing.T) {
+	tests := map[string]struct {
+		source WasmSource
+		want   string
+	}{
+		"inline module hashed when sha256 omitted": {
+			source: WasmSource{Inline: []byte("module")},
+			want:   "120970d812836f19888625587a4606a5ad23cef31c8684e601771552548fc6b9",
+		},
+		"explicit sha256 on remote module is preserved": {
+			source: WasmSource{
+				HTTPURI: "https://modules.example.com/auth.wasm",
+				Cluster: "wasm-modules",
+				SHA256:  "deadbeef",
+			},
+			want: "deadbeef",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := wasmCode(tc.source)
+			var sha256 string
+			if remote, ok := got.GetStructValue().Fields["remote"]; ok {
+				sha256 = remote.GetStructValue().Fields["sha256"].GetStringValue()
+			} else {
+				sha256 = got.GetStructValue().Fields["local"].GetStructValue().Fields["sha256"].GetStringValue()
+			}
+			if diff := cmp.Diff(tc.want, sha256); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestWasmCodeInlineBytesBase64Encoded(t *testing.T) {
+	got := wasmCode(WasmSource{Inline: []byte("module")})
+
+	want := base64.StdEncoding.EncodeToString([]byte("module"))
+	inlineBytes := got.GetStructValue().Fields["local"].GetStructValue().Fields["inline_bytes"].GetStringValue()
+	if diff := cmp.Diff(want, inlineBytes); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestWasmFilterOrder(t *testing.T) {
+	filter := WasmFilter("ratelimit", WasmRuntimeV8, WasmSource{Inline: []byte("module")}, "{}")
+
+	hcm := HTTPConnectionManager("default/echo", FileAccessLog("/dev/stdout", ""), filter)
+
+	filters := hcm.Config.Fields["http_filters"].GetListValue().Values
+	var got []string
+	for _, f := range filters {
+		got = append(got, f.GetStructValue().Fields["name"].GetStringValue())
+	}
+
+	want := []string{
+		"envoy.gzip",
+		"envoy.grpc_web",
+		"envoy.filters.http.wasm",
+		"envoy.router",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestWasmFilterDisabled(t *testing.T) {
+	name, override := WasmFilterDisabled("envoy.filters.http.wasm")
+
+	if name != "envoy.filters.http.wasm" {
+		t.Fatalf("got filter name %q, want envoy.filters.http.wasm", name)
+	}
+	if disabled := override.GetStructValue().Fields["disabled"].GetBoolValue(); !disabled {
+		t.Fatal("expected disabled override to be true")
+	}
+}
+
+func TestWasmFiltersForVirtualHost(t *testing.T) {
+	vhost := &dag.VirtualHost{
+		WasmFilters: []dag.WasmFilter{{
+			Name:     "my-filter",
+			Runtime:  "wavm",
+			HTTPPath: "/module.wasm",
+			SHA256:   "abc123",
+			Upstream: &dag.Service{Namespace: "default", Name: "module-host", Port: 80},
+		}},
+	}
+
+	got := WasmFiltersForVirtualHost(vhost)
+	if len(got) != 1 {
+		t.Fatalf("got %d filters, want 1", len(got))
+	}
+
+	config := got[0].GetStructValue().Fields["config"].GetStructValue().Fields["config"].GetStructValue().Fields
+	if name := config["name"].GetStringValue(); name != "my-filter" {
+		t.Fatalf("got filter instance name %q, want my-filter", name)
+	}
+	runtime := config["vm_config"].GetStructValue().Fields["runtime"].GetStringValue()
+	if runtime != string(WasmRuntimeWAVM) {
+		t.Fatalf("got runtime %q, want %q", runtime, WasmRuntimeWAVM)
+	}
+	cluster := config["vm_config"].GetStructValue().Fields["code"].GetStructValue().Fields["remote"].GetStructValue().Fields["http_uri"].GetStructValue().Fields["cluster"].GetStringValue()
+	if cluster != "default/module-host/80" {
+		t.Fatalf("got cluster %q, want %q", cluster, "default/module-host/80")
+	}
+}
+
+func TestWasmDisabledOverridesForRoute(t *testing.T) {
+	route := &dag.Route{WasmDisabled: []string{"my-filter"}}
+
+	got := WasmDisabledOverridesForRoute(route)
+	if _, ok := got["my-filter"]; !ok {
+		t.Fatal("expected an override for my-filter")
+	}
+
+	if got := WasmDisabledOverridesForRoute(&dag.Route{}); got != nil {
+		t.Fatalf("got %v, want nil for a route with no WasmDisabled filters", got)
+	}
+}